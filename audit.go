@@ -0,0 +1,69 @@
+package main
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "log"
+    "sort"
+)
+
+// auditStats counts the outcomes of an integrity audit.
+type auditStats struct {
+    OK       int
+    Mismatch int
+    Skipped  int
+    Errors   int
+}
+
+// audit re-downloads the resource of every note in the notebook and compares its SHA-256
+// with the hash recorded in the note body. Nothing is modified.
+func (r *runner) audit(ctx context.Context) auditStats {
+    var stats auditStats
+
+    titles := make([]string, 0, len(r.notesByTitle))
+    for title := range r.notesByTitle {
+        titles = append(titles, title)
+    }
+    sort.Strings(titles)
+
+    for _, title := range titles {
+        if ctx.Err() != nil || r.stopping.Load() {
+            break
+        }
+
+        note := r.notesByTitle[title]
+        recorded := parseBodyMeta(note.Body)["sha256"]
+        ids := extractResourceIDs(note.Body)
+        if recorded == "" || len(ids) == 0 {
+            stats.Skipped++
+            fmt.Fprintf(r.out, "%s | audit=skipped (no recorded hash or resource)\n", title)
+            continue
+        }
+
+        // The managed resource link is always the last one in the body.
+        resourceID := ids[len(ids)-1]
+
+        h := sha256.New()
+        if err := r.client.DownloadResource(ctx, resourceID, h); err != nil {
+            stats.Errors++
+            log.Printf("ERROR downloading resource %s for %s: %v", resourceID, title, err)
+            fmt.Fprintf(r.out, "%s | audit=error\n", title)
+            continue
+        }
+        actual := hex.EncodeToString(h.Sum(nil))
+
+        if actual != recorded {
+            stats.Mismatch++
+            fmt.Fprintf(r.out, "%s | audit=MISMATCH resource=%s recorded=%s actual=%s\n", title, resourceID, recorded, actual)
+            continue
+        }
+
+        stats.OK++
+        fmt.Fprintf(r.out, "%s | audit=ok\n", title)
+    }
+
+    fmt.Fprintf(r.out, "Audit summary: ok=%d mismatch=%d skipped=%d errors=%d\n", stats.OK, stats.Mismatch, stats.Skipped, stats.Errors)
+    return stats
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+    "bufio"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "os"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+)
+
+// fileSHA256 returns the hex-encoded SHA-256 of the file content and the number of bytes hashed.
+func fileSHA256(path string) (string, int64, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return "", 0, fmt.Errorf("open file: %w", err)
+    }
+    defer f.Close()
+
+    h := sha256.New()
+    n, err := io.Copy(h, f)
+    if err != nil {
+        return "", 0, fmt.Errorf("hash file: %w", err)
+    }
+    return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// sanitizeUTF8 replaces invalid UTF-8 sequences (possible in file names on Unix) with U+FFFD,
+// so they can be embedded in JSON payloads and note bodies. It reports whether anything changed.
+func sanitizeUTF8(s string) (string, bool) {
+    if utf8.ValidString(s) {
+        return s, false
+    }
+    return strings.ToValidUTF8(s, "\uFFFD"), true
+}
+
+// normalizeBody removes leading blank lines, collapses every run of blank (or whitespace-only) lines into a
+// single empty line and ends the body with exactly one newline. Applying it twice gives the same result, so
+// regenerated bodies only differ when their content does.
+func normalizeBody(body string) string {
+    var b strings.Builder
+    blank := false
+    for _, line := range strings.Split(body, "\n") {
+        if strings.TrimSpace(line) == "" {
+            blank = b.Len() > 0
+            continue
+        }
+        if blank {
+            b.WriteString("\n")
+            blank = false
+        }
+        b.WriteString(line)
+        b.WriteString("\n")
+    }
+    return b.String()
+}
+
+// joinBody puts the generated link block after user content (a sidecar or a rendered --body_template),
+// separated by one blank line. The content is kept as written, apart from trailing newlines, so blank lines
+// that matter to it (e.g. inside fenced code blocks) survive; only the link block is normalized.
+func joinBody(content, link string) string {
+    return strings.TrimRight(content, "\n") + "\n\n" + normalizeBody(link)
+}
+
+// parseBodyMeta extracts the `key: "value"` metadata lines written at the top of a note body.
+// Lines that are not quoted metadata (links, user text) are ignored.
+func parseBodyMeta(body string) map[string]string {
+    meta := make(map[string]string)
+
+    sc := bufio.NewScanner(strings.NewReader(body))
+    sc.Buffer(make([]byte, 0, 64*1024), len(body)+1)
+    for sc.Scan() {
+        key, value, ok := strings.Cut(sc.Text(), ":")
+        if !ok || key == "" || strings.ContainsAny(key, " \t[]()") {
+            continue
+        }
+        unquoted, err := strconv.Unquote(strings.TrimSpace(value))
+        if err != nil {
+            continue
+        }
+        meta[key] = unquoted
+    }
+
+    return meta
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+    "context"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+    "unicode/utf8"
+
+    "github.com/volodymyroliinyk/go-joplin-file-backup/joplin"
+)
+
+func TestSanitizeUTF8(t *testing.T) {
+    tests := []struct {
+        in      string
+        want    string
+        changed bool
+    }{
+        {"map.smmx", "map.smmx", false},
+        {"карта.smmx", "карта.smmx", false},
+        {"bad\xffname.smmx", "bad�name.smmx", true},
+        {"\xc3\x28.smmx", "�(.smmx", true},
+    }
+    for _, tt := range tests {
+        got, changed := sanitizeUTF8(tt.in)
+        if got != tt.want || changed != tt.changed {
+            t.Errorf("sanitizeUTF8(%q) = %q, %v; want %q, %v", tt.in, got, changed, tt.want, tt.changed)
+        }
+    }
+}
+
+// A file whose name is not valid UTF-8 is backed up under a sanitized title and body instead of failing.
+func TestProcessFileInvalidUTF8Name(t *testing.T) {
+    s := newStubJoplin(t)
+    root := t.TempDir()
+    path := filepath.Join(root, "bad\xffname.smmx")
+    if err := os.WriteFile(path, []byte("mind map"), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    info, err := os.Stat(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    r := newTestRunner(s, root)
+    result := r.processFile(context.Background(), path, info)
+    if result.err != nil || result.Status != "added" {
+        t.Fatalf("status %q, err %v", result.Status, result.err)
+    }
+
+    notes := s.notesTitled("bad�name.smmx")
+    if len(notes) != 1 {
+        t.Fatalf("got %d notes with the sanitized title, want 1", len(notes))
+    }
+    body := notes[0].Body
+    if !utf8.ValidString(body) {
+        t.Errorf("body is not valid UTF-8: %q", body)
+    }
+    if meta := parseBodyMeta(body); !strings.HasSuffix(meta["file_path"], "bad�name.smmx") {
+        t.Errorf("file_path = %q, want the sanitized path", meta["file_path"])
+    }
+}
+
+func TestNormalizeBodyFixedPoint(t *testing.T) {
+    tests := []struct {
+        in, want string
+    }{
+        {"", ""},
+        {"a", "a\n"},
+        {"\n\na\n", "a\n"},
+        {"a\n\n\n\nb\n\n", "a\n\nb\n"},
+        {"a\n  \n\t\nb", "a\n\nb\n"},
+        {"a: \"1\"\n\n[x](:/0123456789abcdef0123456789abcdef)\n\n\n", "a: \"1\"\n\n[x](:/0123456789abcdef0123456789abcdef)\n"},
+    }
+    for _, tt := range tests {
+        got := normalizeBody(tt.in)
+        if got != tt.want {
+            t.Errorf("normalizeBody(%q) = %q, want %q", tt.in, got, tt.want)
+        }
+        if again := normalizeBody(got); again != got {
+            t.Errorf("normalizeBody is not idempotent on %q: %q", got, again)
+        }
+    }
+}
+
+// An unchanged re-run leaves the note alone.
+func TestProcessFileUnchangedRerunIsNoop(t *testing.T) {
+    s := newStubJoplin(t)
+    root := t.TempDir()
+    path := filepath.Join(root, "map.smmx")
+    if err := os.WriteFile(path, []byte("mind map"), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    info, err := os.Stat(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    r := newTestRunner(s, root)
+    if result := r.processFile(context.Background(), path, info); result.Status != "added" {
+        t.Fatalf("first run: status %q, err %v", result.Status, result.err)
+    }
+    stored := s.notesTitled("map.smmx")[0].Body
+    if normalizeBody(stored) != stored {
+        t.Errorf("stored body is not normalized: %q", stored)
+    }
+
+    if result := r.processFile(context.Background(), path, info); result.Status != "unchanged" {
+        t.Errorf("second run: status %q, want unchanged", result.Status)
+    }
+    if body := s.notesTitled("map.smmx")[0].Body; body != stored {
+        t.Errorf("second run rewrote the body:\n%q\nwant\n%q", body, stored)
+    }
+}
+
+// Sidecar content is kept as written, including the blank lines of a fenced code block, and regenerating the
+// body gives the same result.
+func TestNoteBodyKeepsSidecarContent(t *testing.T) {
+    root := t.TempDir()
+    path := filepath.Join(root, "map.smmx")
+    sidecar := "# Notes\n\n```\nline 1\n\n\nline 2\n```\n\n\n"
+    if err := os.WriteFile(path+".md", []byte(sidecar), 0o644); err != nil {
+        t.Fatal(err)
+    }
+
+    r := &runner{sidecarSuffix: ".md"}
+    link := resourceLink("map.smmx", "0123456789abcdef0123456789abcdef")
+    body, err := r.noteBody(path, "map.smmx", time.Now(), "", 0, "", link, "", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := "# Notes\n\n```\nline 1\n\n\nline 2\n```\n\n" + link
+    if body != want {
+        t.Errorf("body = %q, want %q", body, want)
+    }
+
+    expected, err := r.expectedBody(path, "map.smmx", joplin.Note{Body: body})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if expected != body {
+        t.Errorf("regenerated body = %q, want %q", expected, body)
+    }
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+    "fmt"
+    "io"
+    "os"
+    "strings"
+    "text/template"
+    "time"
+)
+
+// bodyTemplateData is the data available to --body_template.
+type bodyTemplateData struct {
+    Title      string
+    Path       string
+    CreatedAt  time.Time
+    UploadAt   time.Time
+    ResourceID string
+    Size       int64
+    SHA256     string
+    // ExternalLocation is set instead of ResourceID for files stored with --external_store.
+    ExternalLocation string
+    // GitCommit and GitStatus are set with --include_git.
+    GitCommit string
+    GitStatus string
+    // CompanionsSHA256 identifies the --companion_extensions files; empty without companions.
+    CompanionsSHA256 string
+}
+
+// loadBodyTemplate returns the --body_template text, or the content of --body_template_file.
+func loadBodyTemplate(text, file string) (string, error) {
+    if file == "" {
+        return text, nil
+    }
+    if text != "" {
+        return "", fmt.Errorf("pass either --body_template or --body_template_file, not both")
+    }
+    path, err := expandPath(file)
+    if err != nil {
+        return "", err
+    }
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return "", err
+    }
+    return string(data), nil
+}
+
+// parseBodyTemplate compiles the note body template and renders it once against a sample file, so unknown
+// fields or bad syntax fail before the walk starts.
+func parseBodyTemplate(text string) (*template.Template, error) {
+    tmpl, err := template.New("body").Option("missingkey=error").Funcs(templateFuncs).Parse(text)
+    if err != nil {
+        return nil, fmt.Errorf("parse body template: %w", err)
+    }
+
+    if err := tmpl.Execute(io.Discard, sampleBodyData()); err != nil {
+        return nil, fmt.Errorf("render body template: %w", err)
+    }
+
+    return tmpl, nil
+}
+
+// sampleBodyData is the sample file the body template is checked against at startup.
+func sampleBodyData() bodyTemplateData {
+    now := time.Now()
+    return bodyTemplateData{Title: "file.ext", Path: "/dir/file.ext", CreatedAt: now, UploadAt: now, ResourceID: previewResourceID, Size: 1, SHA256: strings.Repeat("0", 64)}
+}
+
+// missingBodyMeta renders the body template for the sample file and returns the metadata keys, of sha256
+// and file_path, that parseBodyMeta cannot recover from the result.
+func missingBodyMeta(tmpl *template.Template) []string {
+    sample := sampleBodyData()
+    var b strings.Builder
+    if err := tmpl.Execute(&b, sample); err != nil {
+        return []string{"sha256", "file_path"}
+    }
+    meta := parseBodyMeta(b.String())
+
+    var missing []string
+    if meta["sha256"] != sample.SHA256 {
+        missing = append(missing, "sha256")
+    }
+    if meta["file_path"] != sample.Path {
+        missing = append(missing, "file_path")
+    }
+    return missing
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestMissingBodyMeta(t *testing.T) {
+    tests := []struct {
+        name string
+        text string
+        want []string
+    }{
+        {"both", "sha256: \"{{.SHA256}}\"\nfile_path: {{printf \"%q\" .Path}}\n", nil},
+        {"no sha256", "file_path: {{printf \"%q\" .Path}}\n", []string{"sha256"}},
+        {"unquoted path", "sha256: \"{{.SHA256}}\"\nfile_path: {{.Path}}\n", []string{"file_path"}},
+        {"prose only", "Backed up from {{.Path}} ({{.SHA256}})\n", []string{"sha256", "file_path"}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            tmpl, err := parseBodyTemplate(tt.text)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if got := missingBodyMeta(tmpl); !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("missingBodyMeta = %q, want %q", got, tt.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "path/filepath"
+    "strings"
+    "sync"
+
+    "github.com/volodymyroliinyk/go-joplin-file-backup/joplin"
+)
+
+// noteResources returns the resources attached to a note, as listed by Joplin.
+// When the listing is unavailable (server mode, older Joplin versions, errors) the IDs are parsed
+// from the note body instead, and the returned resources carry no title.
+func (r *runner) noteResources(ctx context.Context, note joplin.Note) []joplin.Resource {
+    resources, err := r.client.NoteResources(ctx, note.ID)
+    if err == nil {
+        return resources
+    }
+    if !errors.Is(err, joplin.ErrServerModeUnsupported) {
+        log.Printf("WARNING: cannot list resources of %q, using the links in its body: %v", note.Title, err)
+    }
+
+    for _, id := range extractResourceIDs(note.Body) {
+        resources = append(resources, joplin.Resource{ID: id})
+    }
+    return resources
+}
+
+// resourceIDs returns the IDs of resources, in order.
+func resourceIDs(resources []joplin.Resource) []string {
+    ids := make([]string, len(resources))
+    for i, res := range resources {
+        ids[i] = res.ID
+    }
+    return ids
+}
+
+// uniqueResourceTitle returns title, or "name (n).ext" with the smallest n >= 2 that none of the
+// existing resources uses as its title.
+func uniqueResourceTitle(title string, existing []joplin.Resource) string {
+    taken := make(map[string]bool, len(existing))
+    for _, res := range existing {
+        taken[res.Title] = true
+    }
+    if !taken[title] {
+        return title
+    }
+
+    ext := filepath.Ext(title)
+    stem := strings.TrimSuffix(title, ext)
+    for n := 2; ; n++ {
+        candidate := fmt.Sprintf("%s (%d)%s", stem, n, ext)
+        if !taken[candidate] {
+            return candidate
+        }
+    }
+}
+
+// deleteResources deletes the given resources, running at most cap(r.cleanupSem) deletions at a time
+// across the whole run. Every deletion is attempted regardless of other failures; the returned slice
+// holds the error (or nil) for each ID, in input order.
+func (r *runner) deleteResources(ctx context.Context, ids []string) []error {
+    errs := make([]error, len(ids))
+
+    var wg sync.WaitGroup
+    for i, id := range ids {
+        wg.Add(1)
+        r.cleanupSem <- struct{}{}
+        go func() {
+            defer wg.Done()
+            defer func() { <-r.cleanupSem }()
+            errs[i] = r.client.DeleteResource(ctx, id)
+        }()
+    }
+    wg.Wait()
+
+    return errs
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "path/filepath"
+    "sort"
+)
+
+// collisionReport prints, without modifying anything, every note title that exists more than once in the
+// notebook and every file name that appears in more than one directory under root. Files are selected like
+// in a backup run, by want in directories for which descend is true. It returns the number of colliding
+// note titles and file names.
+func (r *runner) collisionReport(ctx context.Context, root string, descend func(path string) bool, want func(path string, info os.FileInfo) bool) (int, int, error) {
+    notes, err := r.client.NotesByTitleMulti(ctx, r.notebookId)
+    if err != nil {
+        return 0, 0, err
+    }
+
+    var titles []string
+    for title, list := range notes {
+        if len(list) > 1 {
+            titles = append(titles, title)
+        }
+    }
+    sort.Strings(titles)
+
+    fmt.Fprintf(r.out, "Note titles with more than one note: %d\n", len(titles))
+    for _, title := range titles {
+        fmt.Fprintf(r.out, "  %s\n", title)
+        for _, n := range notes[title] {
+            fmt.Fprintf(r.out, "    note %s\n", n.ID)
+        }
+    }
+
+    dirsByName := make(map[string][]string)
+    err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+        if err != nil {
+            return nil
+        }
+        if info.IsDir() {
+            if !descend(path) {
+                return filepath.SkipDir
+            }
+            return nil
+        }
+        if !want(path, info) {
+            return nil
+        }
+        dirsByName[info.Name()] = append(dirsByName[info.Name()], filepath.Dir(path))
+        return nil
+    })
+    if err != nil {
+        return 0, 0, fmt.Errorf("scan %s: %w", root, err)
+    }
+
+    var names []string
+    for name, dirs := range dirsByName {
+        if len(dirs) > 1 {
+            names = append(names, name)
+        }
+    }
+    sort.Strings(names)
+
+    fmt.Fprintf(r.out, "File names found in more than one directory: %d\n", len(names))
+    for _, name := range names {
+        fmt.Fprintf(r.out, "  %s\n", name)
+        for _, dir := range dirsByName[name] {
+            fmt.Fprintf(r.out, "    %s\n", dir)
+        }
+    }
+
+    return len(titles), len(names), nil
+}
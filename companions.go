@@ -0,0 +1,108 @@
+package main
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+// companionFile is a file attached to the note of the primary file with the same base name
+// (--companion_extensions), e.g. the thumbnail map.png of map.smmx.
+type companionFile struct {
+    path string
+    name string
+    size int64
+}
+
+// findCompanions returns the companion files that exist next to path, in extension order, and a hash over
+// their names and content that changes whenever one is added, removed or modified. Without companions
+// the hash is empty, so notes written before companions were configured still compare equal.
+func (r *runner) findCompanions(path string) ([]companionFile, string, error) {
+    if len(r.companionExts) == 0 {
+        return nil, "", nil
+    }
+
+    exts := make([]string, 0, len(r.companionExts))
+    for ext := range r.companionExts {
+        exts = append(exts, ext)
+    }
+    sort.Strings(exts)
+
+    base := strings.TrimSuffix(path, filepath.Ext(path))
+    var files []companionFile
+    h := sha256.New()
+    for _, ext := range exts {
+        candidate := base + ext
+        if candidate == path {
+            continue
+        }
+        info, err := os.Stat(candidate)
+        if os.IsNotExist(err) {
+            continue
+        }
+        if err != nil {
+            return nil, "", fmt.Errorf("companion %s: %w", candidate, err)
+        }
+        if !info.Mode().IsRegular() {
+            continue
+        }
+
+        release := r.client.OpenFiles.Acquire()
+        sum, size, err := fileSHA256(candidate)
+        release()
+        if err != nil {
+            return nil, "", fmt.Errorf("companion %s: %w", candidate, err)
+        }
+        name, _ := sanitizeUTF8(filepath.Base(candidate))
+        files = append(files, companionFile{path: candidate, name: name, size: size})
+        fmt.Fprintf(h, "%s\x00%s\n", name, sum)
+    }
+
+    if len(files) == 0 {
+        return nil, "", nil
+    }
+    return files, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// storeCompanions uploads the companion files as resources and returns their links, to be placed before the
+// primary file's link so that it stays the note's last (managed) link. If one upload fails, the resources
+// already uploaded are deleted again.
+func (r *runner) storeCompanions(ctx context.Context, path string, files []companionFile) (string, []string, error) {
+    var links strings.Builder
+    var ids []string
+    for _, f := range files {
+        res, err := r.storeResource(ctx, f.path, f.name, f.size)
+        if err != nil {
+            for _, id := range ids {
+                r.rollbackResource(ctx, id, path)
+            }
+            return "", nil, fmt.Errorf("upload companion %s: %w", f.name, err)
+        }
+        ids = append(ids, res.ID)
+        links.WriteString(resourceLink(f.name, res.ID))
+    }
+    return links.String(), ids, nil
+}
+
+// companionLinks returns the links a preview shows for companion files that would be uploaded.
+func companionLinks(files []companionFile) string {
+    var links strings.Builder
+    for _, f := range files {
+        links.WriteString(resourceLink(f.name, previewResourceID))
+    }
+    return links.String()
+}
+
+// linkBlock returns the last paragraph of a note body, where a backup run writes the resource links.
+func linkBlock(body string) string {
+    trimmed := strings.TrimRight(body, "\n")
+    if i := strings.LastIndex(trimmed, "\n\n"); i >= 0 {
+        return trimmed[i+2:] + "\n"
+    }
+    return trimmed + "\n"
+}
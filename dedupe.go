@@ -0,0 +1,115 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "sort"
+
+    "github.com/volodymyroliinyk/go-joplin-file-backup/joplin"
+)
+
+// dedupe groups the notebook's notes, including notes sharing a title, by their recorded sha256 and, for
+// every group with more than one note, keeps the most recently updated note and deletes the others together
+// with the resources no other note references. With dryRun nothing is deleted; the planned deletions are
+// only printed.
+func (r *runner) dedupe(ctx context.Context, dryRun bool) (deleted int, failed int) {
+    byTitle, err := r.client.NotesByTitleMulti(ctx, r.notebookId)
+    if err != nil {
+        log.Printf("ERROR listing notes for dedupe: %v", err)
+        return 0, 1
+    }
+    groups := make(map[string][]joplin.Note)
+    for _, notes := range byTitle {
+        for _, note := range notes {
+            sum := parseBodyMeta(note.Body)["sha256"]
+            if sum == "" {
+                continue
+            }
+            groups[sum] = append(groups[sum], note)
+        }
+    }
+
+    sums := make([]string, 0, len(groups))
+    for sum, notes := range groups {
+        if len(notes) > 1 {
+            sums = append(sums, sum)
+        }
+    }
+    sort.Strings(sums)
+
+    for _, sum := range sums {
+        notes := groups[sum]
+        sort.Slice(notes, func(i, j int) bool {
+            if notes[i].UpdatedTime != notes[j].UpdatedTime {
+                return notes[i].UpdatedTime > notes[j].UpdatedTime
+            }
+            if notes[i].Title != notes[j].Title {
+                return notes[i].Title < notes[j].Title
+            }
+            return notes[i].ID < notes[j].ID
+        })
+
+        keep := notes[0]
+        fmt.Fprintf(r.out, "sha256 %s: keeping %q (%s)\n", sum, keep.Title, keep.ID)
+
+        kept := make(map[string]bool)
+        for _, rid := range resourceIDs(r.noteResources(ctx, keep)) {
+            kept[rid] = true
+        }
+
+        for _, dup := range notes[1:] {
+            if dryRun {
+                fmt.Fprintf(r.out, "  would delete %q (%s)\n", dup.Title, dup.ID)
+                continue
+            }
+            // Listed before the note is deleted, while Joplin still knows its attachments.
+            dupResources := resourceIDs(r.noteResources(ctx, dup))
+            if err := r.client.DeleteNote(ctx, dup.ID); err != nil {
+                log.Printf("ERROR deleting duplicate note %q: %v", dup.Title, err)
+                failed++
+                continue
+            }
+            if r.notesByTitle[dup.Title].ID == dup.ID {
+                if keep.Title == dup.Title {
+                    r.notesByTitle[dup.Title] = keep
+                } else {
+                    delete(r.notesByTitle, dup.Title)
+                }
+            }
+            deleted++
+            fmt.Fprintf(r.out, "  deleted %q (%s)\n", dup.Title, dup.ID)
+
+            var orphaned []string
+            for _, rid := range dupResources {
+                if !kept[rid] && !r.referencedElsewhere(ctx, rid, dup) {
+                    orphaned = append(orphaned, rid)
+                }
+            }
+            for i, err := range r.deleteResources(ctx, orphaned) {
+                if err != nil {
+                    log.Printf("WARNING: failed to delete resource %s of %q: %v", orphaned[i], dup.Title, err)
+                }
+            }
+        }
+    }
+
+    fmt.Fprintf(r.out, "Dedupe summary: duplicate groups=%d deleted=%d errors=%d\n", len(sums), deleted, failed)
+    return deleted, failed
+}
+
+// referencedElsewhere reports whether a note other than dup, in any notebook, still references the
+// resource. When that cannot be checked, the resource is assumed to be in use and kept.
+func (r *runner) referencedElsewhere(ctx context.Context, resourceID string, dup joplin.Note) bool {
+    notes, err := r.client.ResourceNotes(ctx, resourceID)
+    if err != nil {
+        log.Printf("WARNING: keeping resource %s of %q: cannot check its other references: %v", resourceID, dup.Title, err)
+        return true
+    }
+    for _, note := range notes {
+        if note.ID != dup.ID {
+            return true
+        }
+    }
+    return false
+}
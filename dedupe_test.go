@@ -0,0 +1,37 @@
+package main
+
+import (
+    "context"
+    "testing"
+)
+
+func TestDedupeSameTitleKeepsSharedResources(t *testing.T) {
+    s := newStubJoplin(t)
+    own := s.addResource("own")
+    shared := s.addResource("shared")
+    body := metaBody("", "", "/maps/map.smmx", "abc", "3")
+    older := s.addNote("nb", "map.smmx", body+"\n[map.smmx](:/"+own+")\n[map.smmx](:/"+shared+")\n")
+    newer := s.addNote("nb", "map.smmx", body+"\n[map.smmx](:/"+s.addResource("kept")+")\n")
+    s.addNote("other", "Trip", "[map.smmx](:/"+shared+")\n")
+    s.mu.Lock()
+    n := s.notes[newer]
+    n.UpdatedTime = 2
+    s.notes[newer] = n
+    s.mu.Unlock()
+
+    r := newTestRunner(s, t.TempDir())
+    deleted, failed := r.dedupe(context.Background(), false)
+    if deleted != 1 || failed != 0 {
+        t.Fatalf("dedupe = %d deleted, %d failed, want 1, 0", deleted, failed)
+    }
+    notes := s.notesTitled("map.smmx")
+    if len(notes) != 1 || notes[0].ID != newer {
+        t.Fatalf("remaining notes = %+v, want only %s (deleted %s)", notes, newer, older)
+    }
+    if s.hasResource(own) {
+        t.Errorf("resource %s only the duplicate linked was kept", own)
+    }
+    if !s.hasResource(shared) {
+        t.Errorf("resource %s still linked by another notebook's note was deleted", shared)
+    }
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+)
+
+// unifiedDiff returns a unified diff (without file headers) turning a into b, line by line, with the
+// given number of context lines around each change. It returns "" when a and b are equal.
+// It uses a plain LCS table, which is fine for note bodies but quadratic in the number of lines.
+func unifiedDiff(a, b string, context int) string {
+    al := strings.SplitAfter(a, "\n")
+    bl := strings.SplitAfter(b, "\n")
+    if al[len(al)-1] == "" {
+        al = al[:len(al)-1]
+    }
+    if bl[len(bl)-1] == "" {
+        bl = bl[:len(bl)-1]
+    }
+
+    // lcs[i][j] is the length of the longest common subsequence of al[i:] and bl[j:].
+    lcs := make([][]int, len(al)+1)
+    for i := range lcs {
+        lcs[i] = make([]int, len(bl)+1)
+    }
+    for i := len(al) - 1; i >= 0; i-- {
+        for j := len(bl) - 1; j >= 0; j-- {
+            if al[i] == bl[j] {
+                lcs[i][j] = lcs[i+1][j+1] + 1
+            } else {
+                lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+            }
+        }
+    }
+
+    type op struct {
+        kind byte // ' ', '-' or '+'
+        line string
+        ai   int // lines of a consumed before this op
+        bi   int // lines of b consumed before this op
+    }
+    var ops []op
+    i, j := 0, 0
+    for i < len(al) || j < len(bl) {
+        switch {
+        case i < len(al) && j < len(bl) && al[i] == bl[j]:
+            ops = append(ops, op{' ', al[i], i, j})
+            i++
+            j++
+        case i < len(al) && (j == len(bl) || lcs[i+1][j] >= lcs[i][j+1]):
+            ops = append(ops, op{'-', al[i], i, j})
+            i++
+        default:
+            ops = append(ops, op{'+', bl[j], i, j})
+            j++
+        }
+    }
+
+    var out strings.Builder
+    for start := 0; start < len(ops); {
+        // Find the next change and the extent of its hunk (changes closer than 2*context are merged).
+        first := start
+        for first < len(ops) && ops[first].kind == ' ' {
+            first++
+        }
+        if first == len(ops) {
+            break
+        }
+        last := first
+        for k := first; k < len(ops); k++ {
+            if ops[k].kind != ' ' {
+                last = k
+            } else if k-last > 2*context {
+                break
+            }
+        }
+
+        from := max(first-context, start)
+        to := min(last+context+1, len(ops))
+
+        aCount, bCount := 0, 0
+        for _, o := range ops[from:to] {
+            if o.kind != '+' {
+                aCount++
+            }
+            if o.kind != '-' {
+                bCount++
+            }
+        }
+        fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", ops[from].ai+1, aCount, ops[from].bi+1, bCount)
+        for _, o := range ops[from:to] {
+            out.WriteByte(o.kind)
+            out.WriteString(o.line)
+            if !strings.HasSuffix(o.line, "\n") {
+                out.WriteString("\n\\ No newline at end of text\n")
+            }
+        }
+        start = to
+    }
+    return out.String()
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+
+    "github.com/volodymyroliinyk/go-joplin-file-backup/joplin"
+)
+
+// reportDrift prints, without modifying anything, every note matched by a file under root whose body differs
+// from the body this tool would have written for it, i.e. notes that were edited in Joplin since the last run.
+// The expected body is rebuilt from the values recorded in the note itself, so a changed file alone is not drift.
+// Files are selected like in a backup run, by want in directories for which descend is true.
+// It returns the number of drifted notes.
+func (r *runner) reportDrift(root string, descend func(path string) bool, want func(path string, info os.FileInfo) bool) (int, error) {
+    checked, drifted := 0, 0
+
+    err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+        if err != nil {
+            return nil
+        }
+        if info.IsDir() {
+            if !descend(path) {
+                return filepath.SkipDir
+            }
+            return nil
+        }
+        if !want(path, info) {
+            return nil
+        }
+
+        name, _ := sanitizeUTF8(info.Name())
+        note, ok := r.notesByTitle[r.noteTitle(path, name)]
+        if !ok {
+            return nil
+        }
+        checked++
+
+        expected, err := r.expectedBody(path, name, note)
+        if err != nil {
+            fmt.Fprintf(r.out, "drifted: %s (note %s): %v\n", name, note.ID, err)
+            drifted++
+            return nil
+        }
+        if expected == note.Body {
+            return nil
+        }
+
+        drifted++
+        fmt.Fprintf(r.out, "drifted: %s (note %s)\n", name, note.ID)
+        if line, got, want := firstDifference(note.Body, expected); line > 0 {
+            fmt.Fprintf(r.out, "  line %d: note has %q, expected %q\n", line, got, want)
+        }
+        return nil
+    })
+    if err != nil {
+        return 0, fmt.Errorf("scan %s: %w", root, err)
+    }
+
+    fmt.Fprintf(r.out, "Drift summary: checked=%d drifted=%d\n", checked, drifted)
+    return drifted, nil
+}
+
+// expectedBody rebuilds the body a backup run would have written for note, reusing its recorded metadata
+// and its managed (last) resource link.
+func (r *runner) expectedBody(path, title string, note joplin.Note) (string, error) {
+    meta := parseBodyMeta(note.Body)
+
+    var link string
+    if location := meta["external_location"]; location != "" {
+        link = externalLink(title, location)
+    } else {
+        ids := extractResourceIDs(note.Body)
+        if len(ids) == 0 {
+            return "", fmt.Errorf("managed resource link is missing")
+        }
+        link = resourceLink(title, ids[len(ids)-1])
+    }
+    if meta["companions_sha256"] != "" {
+        // The companion links precede the managed link in the same paragraph.
+        link = linkBlock(note.Body)
+    }
+
+    body, ok, err := r.sidecarBody(path, link)
+    if err != nil {
+        return "", err
+    }
+    if !ok {
+        body = metaBody(meta["created_at"], meta["upload_at"], meta["file_path"], meta["sha256"], meta["size_bytes"])
+        if location := meta["external_location"]; location != "" {
+            body += fmt.Sprintf("external_location: %q\n", location)
+        }
+        if commit := meta["git_commit"]; commit != "" {
+            body += fmt.Sprintf("git_commit: %q\ngit_status: %q\n", commit, meta["git_status"])
+        }
+        if companions := meta["companions_sha256"]; companions != "" {
+            body += fmt.Sprintf("companions_sha256: %q\n", companions)
+        }
+        body = normalizeBody(body + "\n" + link)
+    }
+    return body, nil
+}
+
+// firstDifference returns the 1-based number of the first line where a and b differ, with both lines.
+// It returns 0 when the texts are equal.
+func firstDifference(a, b string) (int, string, string) {
+    al := strings.Split(a, "\n")
+    bl := strings.Split(b, "\n")
+    for i := 0; i < len(al) || i < len(bl); i++ {
+        var x, y string
+        if i < len(al) {
+            x = al[i]
+        }
+        if i < len(bl) {
+            y = bl[i]
+        }
+        if x != y {
+            return i + 1, x, y
+        }
+    }
+    return 0, "", ""
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "os"
+    "path/filepath"
+    "time"
+
+    "github.com/volodymyroliinyk/go-joplin-file-backup/joplin"
+)
+
+// isEmptyDir reports whether a directory has no entries at all. Unreadable directories are not empty;
+// the walk reports them itself.
+func isEmptyDir(path string) bool {
+    f, err := os.Open(path)
+    if err != nil {
+        return false
+    }
+    defer f.Close()
+
+    names, _ := f.Readdirnames(1)
+    return len(names) == 0
+}
+
+// markEmptyDir creates or refreshes the marker note recording an empty directory. Markers carry no resource,
+// only metadata, and are titled by the directory's path relative to the scan root with a trailing "/"
+// (with --mirror_tree, by the directory name inside its parent's notebook). A marker whose body is already
+// up to date is left alone.
+func (r *runner) markEmptyDir(ctx context.Context, path string, info os.FileInfo) fileResult {
+    createdAt := fileCreatedAt(info)
+    result := fileResult{
+        Path:         path,
+        CreatedAtUTC: createdAt.UTC().Format(time.RFC3339Nano),
+    }
+
+    rel, err := filepath.Rel(r.root, path)
+    if err != nil {
+        result.fail(err)
+        return result
+    }
+    rel, _ = sanitizeUTF8(filepath.ToSlash(rel))
+
+    notebookID := r.notebookId
+    title := rel + "/"
+    if r.mirrorTree {
+        var titlePrefix string
+        notebookID, titlePrefix, err = r.notebookFor(ctx, path)
+        if err != nil {
+            log.Printf("ERROR resolving notebook for %s: %v", path, err)
+            result.fail(err)
+            return result
+        }
+        name, _ := sanitizeUTF8(info.Name())
+        title = titlePrefix + name + "/"
+    }
+    result.Title = title
+
+    notes, err := r.notesIn(ctx, notebookID)
+    if err != nil {
+        log.Printf("ERROR loading notes for %s: %v", path, err)
+        result.fail(err)
+        return result
+    }
+
+    body := normalizeBody(fmt.Sprintf(
+        "empty_directory: %q\n"+
+            "created_at: %q\n",
+        rel,
+        createdAt.Format("2006-01-02 15:04:05.000 -0700"),
+    ))
+
+    var existing *joplin.Note
+    if note, ok := r.cachedNote(notes, title); ok {
+        note, err = r.withBody(ctx, notes, note)
+        if err != nil {
+            log.Printf("ERROR loading marker note for %s: %v", path, err)
+            result.fail(err)
+            return result
+        }
+        existing = &note
+        result.NoteID = note.ID
+        if note.Body == body {
+            result.Status = "unchanged"
+            return result
+        }
+    }
+
+    note, status, err := r.client.UpsertNote(ctx, existing, notebookID, title, body, joplin.NoteOptions{})
+    if err != nil {
+        log.Printf("ERROR saving empty directory marker for %s: %v", path, err)
+        result.fail(err)
+        return result
+    }
+    r.cacheNote(notes, title, "", *note)
+    result.Status = status
+    result.NoteID = note.ID
+    return result
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+    "fmt"
+    "path/filepath"
+    "strings"
+)
+
+// extensionSet is the set of lower-cased file extensions (with the dot) selected by --file_extension.
+// An empty set matches every file.
+type extensionSet map[string]bool
+
+// parseExtensions parses a comma-separated list of extensions such as ".smmx,.pdf". Entries are
+// lower-cased and may omit the leading dot; empty entries are ignored.
+func parseExtensions(s string) extensionSet {
+    set := make(extensionSet)
+    for _, ext := range strings.Split(s, ",") {
+        ext = strings.ToLower(strings.TrimSpace(ext))
+        if ext == "" {
+            continue
+        }
+        if !strings.HasPrefix(ext, ".") {
+            ext = "." + ext
+        }
+        set[ext] = true
+    }
+    return set
+}
+
+// match reports whether a file name has one of the extensions, ignoring case.
+func (s extensionSet) match(name string) bool {
+    return len(s) == 0 || s[strings.ToLower(filepath.Ext(name))]
+}
+
+// nameFilter selects files by glob patterns matched against the base name (--include, --exclude).
+type nameFilter struct {
+    include []string
+    exclude []string
+}
+
+// parseNameFilter parses comma-separated lists of include and exclude patterns (filepath.Match syntax).
+// It fails on the first malformed pattern.
+func parseNameFilter(include, exclude string) (*nameFilter, error) {
+    f := &nameFilter{}
+    var err error
+    if f.include, err = parsePatterns(include); err != nil {
+        return nil, fmt.Errorf("--include: %w", err)
+    }
+    if f.exclude, err = parsePatterns(exclude); err != nil {
+        return nil, fmt.Errorf("--exclude: %w", err)
+    }
+    return f, nil
+}
+
+func parsePatterns(s string) ([]string, error) {
+    var patterns []string
+    for _, p := range strings.Split(s, ",") {
+        p = strings.TrimSpace(p)
+        if p == "" {
+            continue
+        }
+        if _, err := filepath.Match(p, ""); err != nil {
+            return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+        }
+        patterns = append(patterns, p)
+    }
+    return patterns, nil
+}
+
+// match reports whether a base name matches at least one include pattern (or there are none)
+// and no exclude pattern.
+func (f *nameFilter) match(name string) bool {
+    included := len(f.include) == 0
+    for _, p := range f.include {
+        if ok, _ := filepath.Match(p, name); ok {
+            included = true
+            break
+        }
+    }
+    if !included {
+        return false
+    }
+    for _, p := range f.exclude {
+        if ok, _ := filepath.Match(p, name); ok {
+            return false
+        }
+    }
+    return true
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+    "fmt"
+    "io"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+)
+
+// parseSize parses a byte count with an optional decimal unit (B, KB, MB, GB, TB), e.g. "500MB".
+func parseSize(value string) (int64, error) {
+    s := strings.ToUpper(strings.TrimSpace(value))
+    mult := int64(1)
+    for _, u := range []struct {
+        suffix string
+        mult   int64
+    }{{"TB", 1e12}, {"GB", 1e9}, {"MB", 1e6}, {"KB", 1e3}, {"B", 1}} {
+        if strings.HasSuffix(s, u.suffix) {
+            s, mult = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.mult
+            break
+        }
+    }
+    n, err := strconv.ParseInt(s, 10, 64)
+    if err != nil || n < 0 {
+        return 0, fmt.Errorf("invalid size %q", value)
+    }
+    return n * mult, nil
+}
+
+// externalLink returns the markdown link to an externally stored file that ends its note body.
+func externalLink(title, location string) string {
+    return fmt.Sprintf("[%s](<%s>)\n", title, location)
+}
+
+// externalName is the name a file is stored under in --external_store: its content hash plus extension.
+func externalName(path, sum string) string {
+    return sum + strings.ToLower(filepath.Ext(path))
+}
+
+// externalLocation returns the location to link to for a stored name: --external_url_base plus the name,
+// or a file:// URL.
+func (r *runner) externalLocation(storedName string) string {
+    if r.externalURLBase != "" {
+        return strings.TrimRight(r.externalURLBase, "/") + "/" + url.PathEscape(storedName)
+    }
+    target := filepath.Join(r.externalStore, storedName)
+    if abs, err := filepath.Abs(target); err == nil {
+        target = abs
+    }
+    return (&url.URL{Scheme: "file", Path: filepath.ToSlash(target)}).String()
+}
+
+// externalize copies a file into --external_store under its content hash and returns its location.
+// Identical content is stored only once.
+func (r *runner) externalize(path, sum string) (string, error) {
+    storedName := externalName(path, sum)
+    target := filepath.Join(r.externalStore, storedName)
+
+    if _, err := os.Stat(target); os.IsNotExist(err) {
+        release := r.client.OpenFiles.Acquire()
+        err := copyFileAtomic(path, target, r.fsyncState)
+        release()
+        if err != nil {
+            return "", err
+        }
+    } else if err != nil {
+        return "", fmt.Errorf("stat %s: %w", target, err)
+    }
+
+    return r.externalLocation(storedName), nil
+}
+
+// copyFileAtomic copies src to dst through a temp file and a rename, like writeStateFile but streaming,
+// so large files are never held in memory and dst never exists half-written.
+func copyFileAtomic(src, dst string, durable bool) error {
+    in, err := os.Open(src)
+    if err != nil {
+        return fmt.Errorf("open file: %w", err)
+    }
+    defer in.Close()
+
+    tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp-*")
+    if err != nil {
+        return fmt.Errorf("create temp file in external store: %w", err)
+    }
+    tmpName := tmp.Name()
+    defer os.Remove(tmpName)
+
+    if _, err := io.Copy(tmp, in); err != nil {
+        tmp.Close()
+        return fmt.Errorf("copy to external store: %w", err)
+    }
+    if durable {
+        if err := tmp.Sync(); err != nil {
+            tmp.Close()
+            return fmt.Errorf("fsync external copy: %w", err)
+        }
+    }
+    if err := tmp.Close(); err != nil {
+        return fmt.Errorf("close external copy: %w", err)
+    }
+    if err := os.Rename(tmpName, dst); err != nil {
+        return fmt.Errorf("rename external copy: %w", err)
+    }
+    if durable {
+        return syncDir(filepath.Dir(dst))
+    }
+    return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+    "bytes"
+    "fmt"
+    "os/exec"
+    "path/filepath"
+    "strings"
+)
+
+// gitInfo is the git state of the scanned directory, captured once per run for --include_git.
+type gitInfo struct {
+    // head is the HEAD commit hash; prefix is the scanned directory relative to the work tree root
+    // ("" at the root, otherwise ending in "/").
+    head   string
+    prefix string
+    root   string
+
+    // changed maps work-tree-relative paths to "modified", "untracked" or "ignored"; entries ending
+    // in "/" stand for whole directories. Files not listed are clean.
+    changed map[string]string
+}
+
+// loadGitInfo reads the git state of dir by running git. It fails if git is not installed or dir is not
+// inside a git work tree.
+func loadGitInfo(dir string) (*gitInfo, error) {
+    out, err := runGit(dir, "rev-parse", "HEAD", "--show-prefix")
+    if err != nil {
+        return nil, err
+    }
+    lines := strings.Split(strings.TrimRight(string(out), "\n"), "\n")
+    if len(lines) < 1 || lines[0] == "" {
+        return nil, fmt.Errorf("git rev-parse: unexpected output %q", out)
+    }
+    g := &gitInfo{head: lines[0], root: dir, changed: make(map[string]string)}
+    if len(lines) > 1 {
+        g.prefix = lines[1]
+    }
+
+    out, err = runGit(dir, "status", "--porcelain", "-z", "--untracked-files=all", "--ignored")
+    if err != nil {
+        return nil, err
+    }
+    entries := bytes.Split(out, []byte{0})
+    for i := 0; i < len(entries); i++ {
+        entry := string(entries[i])
+        if len(entry) < 4 {
+            continue
+        }
+        code, path := entry[:2], entry[3:]
+        switch code {
+        case "??":
+            g.changed[path] = "untracked"
+        case "!!":
+            g.changed[path] = "ignored"
+        default:
+            g.changed[path] = "modified"
+        }
+        if code[0] == 'R' || code[0] == 'C' {
+            // Renames and copies are followed by the original path.
+            i++
+        }
+    }
+    return g, nil
+}
+
+// runGit runs git in dir and returns its standard output.
+func runGit(dir string, args ...string) ([]byte, error) {
+    cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+    var stderr bytes.Buffer
+    cmd.Stderr = &stderr
+    out, err := cmd.Output()
+    if err != nil {
+        return nil, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+    }
+    return out, nil
+}
+
+// status returns the git status of a file under the scanned directory: "clean", "modified",
+// "untracked" or "ignored".
+func (g *gitInfo) status(path string) string {
+    rel, err := filepath.Rel(g.root, path)
+    if err != nil {
+        return "unknown"
+    }
+    rel = g.prefix + filepath.ToSlash(rel)
+    if s, ok := g.changed[rel]; ok {
+        return s
+    }
+    for p, s := range g.changed {
+        if strings.HasSuffix(p, "/") && strings.HasPrefix(rel, p) {
+            return s
+        }
+    }
+    return "clean"
+}
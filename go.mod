@@ -1,3 +1,3 @@
-module main
+module github.com/volodymyroliinyk/go-joplin-file-backup
 
 go 1.25
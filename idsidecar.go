@@ -0,0 +1,63 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "os"
+
+    "github.com/volodymyroliinyk/go-joplin-file-backup/joplin"
+)
+
+// idSidecarSuffix is appended to a backed up file's path to name its ID sidecar.
+const idSidecarSuffix = ".joplin"
+
+// idSidecar is the content of a <file>.joplin sidecar: the note and resource a file was last backed up to.
+type idSidecar struct {
+    NoteID     string `json:"note_id"`
+    ResourceID string `json:"resource_id"`
+}
+
+// noteFromIDSidecar returns the note recorded in the file's ID sidecar. It returns a nil note when there is
+// no sidecar or the recorded note no longer exists, so the caller falls back to matching by title.
+// recorded reports whether a readable sidecar was found.
+func (r *runner) noteFromIDSidecar(ctx context.Context, path string) (note *joplin.Note, recorded bool, err error) {
+    data, err := os.ReadFile(path + idSidecarSuffix)
+    if os.IsNotExist(err) {
+        return nil, false, nil
+    }
+    if err != nil {
+        return nil, false, fmt.Errorf("read ID sidecar: %w", err)
+    }
+
+    var ids idSidecar
+    if err := json.Unmarshal(data, &ids); err != nil || ids.NoteID == "" {
+        log.Printf("WARNING: ignoring malformed %s", path+idSidecarSuffix)
+        return nil, false, nil
+    }
+
+    note, err = r.client.GetNote(ctx, ids.NoteID)
+    if errors.Is(err, joplin.ErrNotFound) {
+        log.Printf("WARNING: note %s recorded in %s no longer exists, matching by title", ids.NoteID, path+idSidecarSuffix)
+        return nil, false, nil
+    }
+    if err != nil {
+        return nil, false, err
+    }
+    return note, true, nil
+}
+
+// writeIDSidecar records the note and resource a file was backed up to. Failures are logged,
+// since the next run can still match the note by title.
+func (r *runner) writeIDSidecar(path, noteID, resourceID string) {
+    data, err := json.MarshalIndent(idSidecar{NoteID: noteID, ResourceID: resourceID}, "", "  ")
+    if err != nil {
+        log.Printf("WARNING: failed to encode ID sidecar for %s: %v", path, err)
+        return
+    }
+    if err := writeStateFile(path+idSidecarSuffix, append(data, '\n'), r.fsyncState); err != nil {
+        log.Printf("WARNING: failed to write %s: %v", path+idSidecarSuffix, err)
+    }
+}
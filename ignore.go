@@ -0,0 +1,157 @@
+package main
+
+import (
+    "bufio"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// ignoreFileName is the ignore file looked up in the scan root when --ignore_file is not given.
+const ignoreFileName = ".joplinignore"
+
+// ignoreRule is one pattern line of an ignore file.
+type ignoreRule struct {
+    // segments is the pattern split at "/"; "**" matches any number of path segments.
+    segments []string
+    negate   bool
+    dirOnly  bool
+}
+
+// ignoreRules excludes paths under root by gitignore-style patterns: "#" comments, "!" negation, a trailing
+// "/" for directories only, and patterns containing a "/" anchored at root (others match at any depth).
+// The last matching rule wins, and nothing inside an ignored directory can be re-included. A nil
+// *ignoreRules ignores nothing.
+type ignoreRules struct {
+    root  string
+    path  string
+    rules []ignoreRule
+}
+
+// loadIgnoreFile reads the ignore file for a scan of root: path if set, otherwise root/.joplinignore if it
+// exists. It returns nil when there is nothing to ignore.
+func loadIgnoreFile(root, path string) (*ignoreRules, error) {
+    explicit := path != ""
+    if !explicit {
+        path = filepath.Join(root, ignoreFileName)
+    }
+    f, err := os.Open(path)
+    if errors.Is(err, os.ErrNotExist) && !explicit {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+
+    ig := &ignoreRules{root: root, path: path}
+    sc := bufio.NewScanner(f)
+    for line := 1; sc.Scan(); line++ {
+        rule, ok, err := parseIgnoreLine(sc.Text())
+        if err != nil {
+            return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+        }
+        if ok {
+            ig.rules = append(ig.rules, rule)
+        }
+    }
+    if err := sc.Err(); err != nil {
+        return nil, fmt.Errorf("read %s: %w", path, err)
+    }
+    return ig, nil
+}
+
+func parseIgnoreLine(line string) (ignoreRule, bool, error) {
+    line = strings.TrimRight(line, " \t\r")
+    if line == "" || strings.HasPrefix(line, "#") {
+        return ignoreRule{}, false, nil
+    }
+
+    var rule ignoreRule
+    if strings.HasPrefix(line, "!") {
+        rule.negate = true
+        line = line[1:]
+    } else if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+        line = line[1:]
+    }
+    if strings.HasSuffix(line, "/") {
+        rule.dirOnly = true
+        line = strings.TrimRight(line, "/")
+    }
+    anchored := strings.Contains(line, "/")
+    line = strings.TrimPrefix(line, "/")
+    if line == "" {
+        return ignoreRule{}, false, nil
+    }
+
+    rule.segments = strings.Split(line, "/")
+    if !anchored {
+        rule.segments = append([]string{"**"}, rule.segments...)
+    }
+    for _, seg := range rule.segments {
+        if _, err := filepath.Match(seg, ""); err != nil {
+            return ignoreRule{}, false, fmt.Errorf("bad pattern %q: %w", line, err)
+        }
+    }
+    return rule, true, nil
+}
+
+// ignored reports whether path, a file or a directory under the root, is excluded, either itself or
+// through one of its parent directories. The ignore file itself is always excluded.
+func (ig *ignoreRules) ignored(path string, isDir bool) bool {
+    if ig == nil {
+        return false
+    }
+    if path == ig.path {
+        return true
+    }
+    rel, err := filepath.Rel(ig.root, path)
+    if err != nil || rel == "." {
+        return false
+    }
+    parts := strings.Split(filepath.ToSlash(rel), "/")
+    for i := 1; i < len(parts); i++ {
+        if ig.match(parts[:i], true) {
+            return true
+        }
+    }
+    return ig.match(parts, isDir)
+}
+
+// match applies the rules to a relative path given as segments; the last matching rule decides.
+func (ig *ignoreRules) match(parts []string, isDir bool) bool {
+    ignored := false
+    for _, rule := range ig.rules {
+        if rule.dirOnly && !isDir {
+            continue
+        }
+        if matchSegments(rule.segments, parts) {
+            ignored = !rule.negate
+        }
+    }
+    return ignored
+}
+
+// matchSegments matches path segments against pattern segments, where "**" stands for zero or more segments.
+func matchSegments(pattern, parts []string) bool {
+    if len(pattern) == 0 {
+        return len(parts) == 0
+    }
+    if pattern[0] == "**" {
+        for i := 0; i <= len(parts); i++ {
+            if matchSegments(pattern[1:], parts[i:]) {
+                return true
+            }
+        }
+        return false
+    }
+    if len(parts) == 0 {
+        return false
+    }
+    if ok, _ := filepath.Match(pattern[0], parts[0]); !ok {
+        return false
+    }
+    return matchSegments(pattern[1:], parts[1:])
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "sort"
+    "strings"
+
+    "github.com/volodymyroliinyk/go-joplin-file-backup/joplin"
+)
+
+// linkToNote returns a Markdown link to another note using Joplin's ":/id" syntax,
+// the same form used for resource links.
+func linkToNote(id, title string) string {
+    title = strings.NewReplacer("[", `\[`, "]", `\]`).Replace(title)
+    return fmt.Sprintf("[%s](:/%s)", title, id)
+}
+
+// indexBody renders the index note: one link per note in the notebook, sorted by title.
+func (r *runner) indexBody() string {
+    titles := make([]string, 0, len(r.notesByTitle))
+    for title := range r.notesByTitle {
+        if title == r.indexTitle {
+            continue
+        }
+        titles = append(titles, title)
+    }
+    sort.Strings(titles)
+
+    var b strings.Builder
+    fmt.Fprintf(&b, "# %s\n\n", r.indexTitle)
+    for _, title := range titles {
+        fmt.Fprintf(&b, "- %s\n", linkToNote(r.notesByTitle[title].ID, title))
+    }
+    return b.String()
+}
+
+// updateIndexNote creates or refreshes the index note linking to every backed up note.
+// The note is left untouched when its content has not changed, to avoid sync churn.
+func (r *runner) updateIndexNote(ctx context.Context) error {
+    body := r.indexBody()
+
+    existing, ok := r.notesByTitle[r.indexTitle]
+    if !ok {
+        note, err := r.client.CreateNote(ctx, r.notebookId, r.indexTitle, body, joplin.NoteOptions{})
+        if err != nil {
+            return fmt.Errorf("create index note: %w", err)
+        }
+        r.notesByTitle[r.indexTitle] = *note
+        fmt.Fprintf(r.out, "index note %q created\n", r.indexTitle)
+        return nil
+    }
+
+    existing, err := r.withBody(ctx, r.notesByTitle, existing)
+    if err != nil {
+        return fmt.Errorf("load index note: %w", err)
+    }
+    if existing.Body == body {
+        return nil
+    }
+
+    if err := r.client.UpdateNote(ctx, existing.ID, r.notebookId, r.indexTitle, body, joplin.NoteOptions{}); err != nil {
+        return fmt.Errorf("update index note: %w", err)
+    }
+    existing.Body = body
+    r.notesByTitle[r.indexTitle] = existing
+    fmt.Fprintf(r.out, "index note %q updated\n", r.indexTitle)
+    return nil
+}
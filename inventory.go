@@ -0,0 +1,79 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "sort"
+    "strings"
+    "text/tabwriter"
+
+    "github.com/volodymyroliinyk/go-joplin-file-backup/joplin"
+)
+
+// noteListing is one note of the --list_notes inventory.
+type noteListing struct {
+    Title       string   `json:"title"`
+    ID          string   `json:"id"`
+    FilePath    string   `json:"file_path,omitempty"`
+    SHA256      string   `json:"sha256,omitempty"`
+    ResourceIDs []string `json:"resource_ids"`
+}
+
+// listNotes prints every note of the notebook with its resources and the file path and hash recorded
+// in its body, sorted by title. It writes a table to r.out, or one JSON object per note to the
+// --json_stream encoder. Nothing is modified. It returns the number of notes listed.
+func (r *runner) listNotes(ctx context.Context) (int, error) {
+    byTitle, err := r.client.NotesByTitleMulti(ctx, r.notebookId)
+    if err != nil {
+        return 0, err
+    }
+
+    var notes []joplin.Note
+    for _, list := range byTitle {
+        notes = append(notes, list...)
+    }
+    sort.Slice(notes, func(i, j int) bool {
+        if notes[i].Title != notes[j].Title {
+            return notes[i].Title < notes[j].Title
+        }
+        return notes[i].ID < notes[j].ID
+    })
+
+    tw := tabwriter.NewWriter(r.out, 0, 4, 2, ' ', 0)
+    if r.stream == nil {
+        fmt.Fprintln(tw, "TITLE\tID\tRESOURCES\tFILE PATH\tSHA256")
+    }
+    for _, note := range notes {
+        meta := parseBodyMeta(note.Body)
+        listing := noteListing{
+            Title:       note.Title,
+            ID:          note.ID,
+            FilePath:    meta["file_path"],
+            SHA256:      meta["sha256"],
+            ResourceIDs: resourceIDs(r.noteResources(ctx, note)),
+        }
+        if listing.ResourceIDs == nil {
+            listing.ResourceIDs = []string{}
+        }
+
+        if r.stream != nil {
+            if err := r.stream.Encode(listing); err != nil {
+                return 0, fmt.Errorf("write json stream record for note %s: %w", note.ID, err)
+            }
+            continue
+        }
+        fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", listing.Title, listing.ID, dash(strings.Join(listing.ResourceIDs, ",")), dash(listing.FilePath), dash(listing.SHA256))
+    }
+    if err := tw.Flush(); err != nil {
+        return 0, err
+    }
+    return len(notes), nil
+}
+
+// dash returns s, or "-" for an empty table cell.
+func dash(s string) string {
+    if s == "" {
+        return "-"
+    }
+    return s
+}
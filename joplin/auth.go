@@ -0,0 +1,38 @@
+package joplin
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+)
+
+// ErrAuth is wrapped by CheckAuth when Joplin rejects the credentials.
+var ErrAuth = errors.New("token appears invalid or lacks access")
+
+// CheckAuth performs the cheapest authenticated read (one notebook) to find out whether the token, or the
+// server session, is accepted. A 401/403 response yields an error wrapping ErrAuth.
+func (c *Client) CheckAuth(ctx context.Context) error {
+    var resp *http.Response
+    var err error
+    if c.serverMode() {
+        resp, err = c.serverDo(ctx, http.MethodGet, serverItemPath("")+"/children?limit=1", nil, "")
+    } else {
+        resp, err = c.get(ctx, c.buildURL("/folders", map[string]string{"limit": "1", "fields": "id"}))
+    }
+    if err != nil {
+        return fmt.Errorf("check auth: %w", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+        bodyBytes, _ := io.ReadAll(resp.Body)
+        return fmt.Errorf("%w: status=%d body=%s", ErrAuth, resp.StatusCode, string(bodyBytes))
+    }
+    if resp.StatusCode >= 300 {
+        bodyBytes, _ := io.ReadAll(resp.Body)
+        return fmt.Errorf("check auth failed: status=%d body=%s", resp.StatusCode, string(bodyBytes))
+    }
+    return nil
+}
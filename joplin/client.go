@@ -0,0 +1,495 @@
+// Package joplin is a client for the Joplin Data API (the Web Clipper service of the desktop app) and, after
+// Login, for Joplin Server.
+package joplin
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "strings"
+    "sync"
+    "time"
+)
+
+type Client struct {
+    BaseURL string
+    Token   string
+    HTTP    *http.Client
+    // UserAgent, if set, replaces Go's default User-Agent header.
+    UserAgent string
+    // ResourceMime, if set, is the MIME type of every uploaded file instead of the detected one.
+    ResourceMime string
+    // BearerAuth sends Token in an "Authorization: Bearer" header instead of the token query parameter,
+    // keeping it out of proxy and server access logs.
+    BearerAuth bool
+
+    // SessionID is set by Login; when present the client talks to Joplin Server instead of the Web Clipper API.
+    SessionID string
+
+    // Retries is how many times a transient failure is retried; Budget, if set, caps retries run-wide.
+    Retries int
+    Budget  *RetryBudget
+    // TimeoutBackoff, if > 1, multiplies the HTTP timeout for each retry that follows a timed out attempt.
+    TimeoutBackoff float64
+    // Limiter, if set, bounds the request rate; every attempt, including retries, waits for it.
+    Limiter *RateLimiter
+    // OpenFiles, if set, bounds the number of source files the client and its caller hold open at once.
+    OpenFiles *FileLimiter
+
+    // StrictDecode warns about response fields the client does not model; see decode.
+    StrictDecode bool
+    strictWarned sync.Map
+
+    // timeout is set by WithTimeout and applied by NewClient once all options have run.
+    timeout *time.Duration
+}
+
+type Note struct {
+    ID          string `json:"id"`
+    Title       string `json:"title"`
+    Body        string `json:"body,omitempty"`
+    UpdatedTime int64  `json:"updated_time,omitempty"`
+    CreatedTime int64  `json:"created_time,omitempty"`
+
+    // Partial marks a note listed without its body (NoteTitlesMulti); fetch it with GetNote before use.
+    Partial bool `json:"-"`
+}
+
+type NotesResponse = ListResponse[Note]
+
+type Resource struct {
+    ID            string `json:"id"`
+    Title         string `json:"title"`
+    Size          int64  `json:"size,omitempty"`
+    Mime          string `json:"mime,omitempty"`
+    FileExtension string `json:"file_extension,omitempty"`
+    CreatedTime   int64  `json:"created_time,omitempty"`
+    UpdatedTime   int64  `json:"updated_time,omitempty"`
+}
+
+type ResourcesResponse = ListResponse[Resource]
+
+// resourceFields is the default field list requested by Client.Resource.
+var resourceFields = []string{"id", "title", "size", "mime", "file_extension", "created_time", "updated_time"}
+
+const (
+    JOPLIN_API_BASE    = "http://localhost:41184"
+    JOPLIN_SERVER_BASE = "http://localhost:22300"
+    // JOPLIN_TOKEN    = "ac41d362cc994227eec2b01c2a4f1b3a925eb20d742202f3480e516e68a916dcef7717225ba1e452a37600a48fd7fdb2c2e50b84f0659b2047ad2050cd91d289"
+)
+
+// NewClient returns a client for the Joplin Data API at baseURL that authenticates with token. Without
+// options the client has no request timeout and does not retry; see ClientOption. The default transport asks for gzip (Accept-Encoding) and decompresses responses itself;
+// callers must not set Accept-Encoding, or they have to decompress the body themselves.
+func NewClient(baseURL, token string, opts ...ClientOption) *Client {
+    c := &Client{
+        BaseURL: strings.TrimRight(baseURL, "/"),
+        Token:   token,
+        HTTP:    &http.Client{},
+    }
+    for _, opt := range opts {
+        opt(c)
+    }
+    if c.timeout != nil {
+        // Copied, so a client passed to WithHTTPClient is never modified.
+        hc := *c.HTTP
+        hc.Timeout = *c.timeout
+        c.HTTP = &hc
+    }
+    return c
+}
+
+// buildURL adds path and query parameters, including token (unless it is sent as a header, see BearerAuth).
+func (c *Client) buildURL(path string, params map[string]string) string {
+    if !strings.HasPrefix(path, "/") {
+        path = "/" + path
+    }
+    u, err := url.Parse(c.BaseURL)
+    if err != nil {
+        // fallback, shouldn't normally happen
+        return c.BaseURL + path
+    }
+    u.Path = strings.TrimRight(u.Path, "/") + path
+
+    q := u.Query()
+    if c.Token != "" && !c.BearerAuth {
+        q.Set("token", c.Token)
+    }
+    for k, v := range params {
+        q.Set(k, v)
+    }
+    u.RawQuery = q.Encode()
+    return u.String()
+}
+
+// get is http.Client.Get bound to ctx, with retries.
+func (c *Client) get(ctx context.Context, u string) (*http.Response, error) {
+    return c.send(ctx, http.MethodGet, u, nil, nil)
+}
+
+// post is http.Client.Post bound to ctx, with retries.
+func (c *Client) post(ctx context.Context, u, contentType string, body io.ReadSeeker) (*http.Response, error) {
+    return c.send(ctx, http.MethodPost, u, body, http.Header{"Content-Type": {contentType}})
+}
+
+func (c *Client) Ping(ctx context.Context) error {
+    _, _, err := c.PingDetailed(ctx)
+    return err
+}
+
+// PingDetailed is Ping that also returns the round-trip latency and the /ping response body
+// (e.g. "JoplinClipperServer"). The latency covers retries, if any were needed.
+func (c *Client) PingDetailed(ctx context.Context) (time.Duration, string, error) {
+    start := time.Now()
+    if c.serverMode() {
+        info, err := c.serverPing(ctx)
+        return time.Since(start), info, err
+    }
+
+    u := c.buildURL("/ping", nil)
+    resp, err := c.get(ctx, u)
+    if err != nil {
+        return 0, "", err
+    }
+    defer resp.Body.Close()
+    body, err := io.ReadAll(resp.Body)
+    latency := time.Since(start)
+    if resp.StatusCode != http.StatusOK {
+        return latency, "", fmt.Errorf("ping failed: status=%d body=%s", resp.StatusCode, string(body))
+    }
+    if err != nil {
+        return latency, "", fmt.Errorf("read ping response: %w", err)
+    }
+    return latency, strings.TrimSpace(string(body)), nil
+}
+
+// NotesByTitle returns all notes in the notebook (folder) as a map[title]Note.
+// When several notes share a title, the oldest one is returned; use NotesByTitleMulti to see all of them.
+func (c *Client) NotesByTitle(ctx context.Context, notebookId string) (map[string]Note, error) {
+    multi, err := c.NotesByTitleMulti(ctx, notebookId)
+    if err != nil {
+        return nil, err
+    }
+    return OldestByTitle(multi), nil
+}
+
+// OldestByTitle picks one note per title: the one created first, ties broken by ID. The choice does not
+// depend on listing order, so every run keeps updating the same note of a set sharing a title.
+func OldestByTitle(multi map[string][]Note) map[string]Note {
+    result := make(map[string]Note, len(multi))
+    for title, notes := range multi {
+        oldest := notes[0]
+        for _, n := range notes[1:] {
+            if n.CreatedTime < oldest.CreatedTime || (n.CreatedTime == oldest.CreatedTime && n.ID < oldest.ID) {
+                oldest = n
+            }
+        }
+        result[title] = oldest
+    }
+    return result
+}
+
+// ErrNotFound is wrapped by getters when the requested item does not exist.
+var ErrNotFound = errors.New("not found")
+
+// noteFields is the default field list for GetNote.
+var noteFields = []string{"id", "title", "body", "updated_time"}
+
+// GetNote returns a single note by ID, with the given fields (default: noteFields).
+// A missing note yields an error wrapping ErrNotFound.
+func (c *Client) GetNote(ctx context.Context, id string, fields ...string) (*Note, error) {
+    if c.serverMode() {
+        return c.serverGetNote(ctx, id)
+    }
+    if len(fields) == 0 {
+        fields = noteFields
+    }
+
+    u := c.buildURL("/notes/"+id, map[string]string{"fields": strings.Join(fields, ",")})
+    resp, err := c.get(ctx, u)
+    if err != nil {
+        return nil, fmt.Errorf("get note: %w", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode == http.StatusNotFound {
+        return nil, fmt.Errorf("get note %s: %w", id, ErrNotFound)
+    }
+    if resp.StatusCode >= 300 {
+        bodyBytes, _ := io.ReadAll(resp.Body)
+        return nil, fmt.Errorf("get note failed: status=%d body=%s", resp.StatusCode, string(bodyBytes))
+    }
+
+    var note Note
+    if err := c.decode(resp.Body, &note); err != nil {
+        return nil, fmt.Errorf("decode note: %w", err)
+    }
+
+    return &note, nil
+}
+
+// NotesByTitleMulti returns all notes in the notebook (folder), grouped by title in listing order.
+func (c *Client) NotesByTitleMulti(ctx context.Context, notebookId string) (map[string][]Note, error) {
+    if c.serverMode() {
+        return c.serverNotesByTitle(ctx, notebookId)
+    }
+    return c.notesByTitlePages(ctx, notebookId, "id,title,body,updated_time,created_time", false)
+}
+
+// NoteTitlesMulti is NotesByTitleMulti without the note bodies, for large notebooks where only the notes
+// that match a file need their body; fetch it with GetNote. In server mode the bodies are always included,
+// since the items are downloaded whole.
+func (c *Client) NoteTitlesMulti(ctx context.Context, notebookId string) (map[string][]Note, error) {
+    if c.serverMode() {
+        return c.serverNotesByTitle(ctx, notebookId)
+    }
+    return c.notesByTitlePages(ctx, notebookId, "id,title,updated_time,created_time", true)
+}
+
+// notesByTitlePages lists the notebook's notes with the given fields; partial marks bodies as not loaded.
+func (c *Client) notesByTitlePages(ctx context.Context, notebookId, fields string, partial bool) (map[string][]Note, error) {
+    notes, err := paginate[Note](ctx, c, "/folders/"+notebookId+"/notes", fields, "notes")
+    if err != nil {
+        return nil, err
+    }
+
+    result := make(map[string][]Note)
+    for _, n := range notes {
+        n.Partial = partial
+        result[n.Title] = append(result[n.Title], n)
+    }
+    return result, nil
+}
+
+// Resource fetches the metadata of a resource. Without fields, all fields modelled by Resource are requested.
+func (c *Client) Resource(ctx context.Context, id string, fields ...string) (*Resource, error) {
+    if c.serverMode() {
+        return c.serverResource(ctx, id)
+    }
+    if len(fields) == 0 {
+        fields = resourceFields
+    }
+
+    u := c.buildURL("/resources/"+id, map[string]string{"fields": strings.Join(fields, ",")})
+    resp, err := c.get(ctx, u)
+    if err != nil {
+        return nil, fmt.Errorf("get resource: %w", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode >= 300 {
+        bodyBytes, _ := io.ReadAll(resp.Body)
+        return nil, fmt.Errorf("get resource failed: status=%d body=%s", resp.StatusCode, string(bodyBytes))
+    }
+
+    var res Resource
+    if err := c.decode(resp.Body, &res); err != nil {
+        return nil, fmt.Errorf("decode resource: %w", err)
+    }
+
+    return &res, nil
+}
+
+// NoteResources returns the resources Joplin records as attached to a note (GET /notes/:id/resources).
+func (c *Client) NoteResources(ctx context.Context, noteID string) ([]Resource, error) {
+    if c.serverMode() {
+        return nil, fmt.Errorf("list note resources: %w", ErrServerModeUnsupported)
+    }
+
+    return paginate[Resource](ctx, c, "/notes/"+noteID+"/resources", "id,title", "note resources")
+}
+
+// DeleteResource deletes a resource from Joplin by ID.
+// Does not touch notes, notebooks, tags - only the resource file itself.
+func (c *Client) DeleteResource(ctx context.Context, id string) error {
+    if c.serverMode() {
+        return c.serverDeleteResource(ctx, id)
+    }
+
+    u := c.buildURL("/resources/"+id, nil)
+
+    resp, err := c.send(ctx, http.MethodDelete, u, nil, nil)
+    if err != nil {
+        return fmt.Errorf("do DELETE: %w", err)
+    }
+    defer resp.Body.Close()
+
+    // If the resource has already been deleted, it is not critical.
+    if resp.StatusCode == http.StatusNotFound {
+        return nil
+    }
+
+    if resp.StatusCode >= 300 {
+        bodyBytes, _ := io.ReadAll(resp.Body)
+        return fmt.Errorf("delete resource failed: status=%d body=%s", resp.StatusCode, string(bodyBytes))
+    }
+
+    return nil
+}
+
+// DownloadResource writes the stored file of a resource to w.
+func (c *Client) DownloadResource(ctx context.Context, id string, w io.Writer) error {
+    if c.serverMode() {
+        data, err := c.serverGetItem(ctx, ".resource/"+id)
+        if err != nil {
+            return err
+        }
+        _, err = w.Write(data)
+        return err
+    }
+
+    u := c.buildURL("/resources/"+id+"/file", nil)
+    resp, err := c.get(ctx, u)
+    if err != nil {
+        return fmt.Errorf("get resource file: %w", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode >= 300 {
+        bodyBytes, _ := io.ReadAll(resp.Body)
+        return fmt.Errorf("download resource failed: status=%d body=%s", resp.StatusCode, string(bodyBytes))
+    }
+
+    if _, err := io.Copy(w, resp.Body); err != nil {
+        return fmt.Errorf("read resource file: %w", err)
+    }
+    return nil
+}
+
+// NoteOptions holds optional note fields for CreateNote and UpdateNote; zero values are not sent.
+type NoteOptions struct {
+    // Order is Joplin's manual sort position. It only affects notebooks sorted in "Custom order" mode.
+    Order int64
+    // UserCreatedTime and UserUpdatedTime (Unix milliseconds) are the creation and update dates Joplin
+    // displays and sorts by; unset, Joplin uses the time of the request.
+    UserCreatedTime int64
+    UserUpdatedTime int64
+}
+
+// notePayload builds the JSON payload shared by CreateNote and UpdateNote.
+func notePayload(notebookId, title, body string, opts NoteOptions) map[string]any {
+    payload := map[string]any{
+        "title":     title,
+        "parent_id": notebookId,
+        "body":      body,
+    }
+    if opts.Order != 0 {
+        payload["order"] = opts.Order
+    }
+    if opts.UserCreatedTime != 0 {
+        payload["user_created_time"] = opts.UserCreatedTime
+    }
+    if opts.UserUpdatedTime != 0 {
+        payload["user_updated_time"] = opts.UserUpdatedTime
+    }
+    return payload
+}
+
+// CreateNote creates a new note in the given notebook.
+func (c *Client) CreateNote(ctx context.Context, notebookId, title, body string, opts NoteOptions) (*Note, error) {
+    if c.serverMode() {
+        return c.serverCreateNote(ctx, notebookId, title, body, opts)
+    }
+
+    payload := notePayload(notebookId, title, body, opts)
+    data, err := json.Marshal(payload)
+    if err != nil {
+        return nil, fmt.Errorf("marshal note: %w", err)
+    }
+
+    u := c.buildURL("/notes", nil)
+    resp, err := c.post(ctx, u, "application/json", bytes.NewReader(data))
+    if err != nil {
+        return nil, fmt.Errorf("post note: %w", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode >= 300 {
+        bodyBytes, _ := io.ReadAll(resp.Body)
+        return nil, fmt.Errorf("create note failed: status=%d body=%s", resp.StatusCode, string(bodyBytes))
+    }
+
+    var note Note
+    if err := c.decode(resp.Body, &note); err != nil {
+        return nil, fmt.Errorf("decode note: %w", err)
+    }
+
+    return &note, nil
+}
+
+// UpdateNote updates an existing note (title, parent_id, body and any set options).
+func (c *Client) UpdateNote(ctx context.Context, id, notebookId, title, body string, opts NoteOptions) error {
+    if c.serverMode() {
+        return c.serverUpdateNote(ctx, id, notebookId, title, body, opts)
+    }
+
+    payload := notePayload(notebookId, title, body, opts)
+    data, err := json.Marshal(payload)
+    if err != nil {
+        return fmt.Errorf("marshal note update: %w", err)
+    }
+
+    u := c.buildURL("/notes/"+id, nil)
+    resp, err := c.send(ctx, http.MethodPut, u, bytes.NewReader(data), http.Header{"Content-Type": {"application/json"}})
+    if err != nil {
+        return fmt.Errorf("do PUT: %w", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode >= 300 {
+        bodyBytes, _ := io.ReadAll(resp.Body)
+        return fmt.Errorf("update note failed: status=%d body=%s", resp.StatusCode, string(bodyBytes))
+    }
+
+    return nil
+}
+
+// UpsertNote creates the note when existing is nil and updates it otherwise.
+// It returns the saved note and "added" or "updated". After an update, resources referenced by
+// existing.Body but not by body are no longer used by the note; see staleResources.
+func (c *Client) UpsertNote(ctx context.Context, existing *Note, notebookId, title, body string, opts NoteOptions) (*Note, string, error) {
+    if existing == nil {
+        note, err := c.CreateNote(ctx, notebookId, title, body, opts)
+        if err != nil {
+            return nil, "", err
+        }
+        return note, "added", nil
+    }
+
+    if err := c.UpdateNote(ctx, existing.ID, notebookId, title, body, opts); err != nil {
+        return nil, "", err
+    }
+    return &Note{ID: existing.ID, Title: title, Body: body, UpdatedTime: existing.UpdatedTime}, "updated", nil
+}
+
+// DeleteNote deletes a note from Joplin by ID. A note that no longer exists is not an error.
+// Resources referenced by the note are not deleted.
+func (c *Client) DeleteNote(ctx context.Context, id string) error {
+    if c.serverMode() {
+        return c.serverDeleteItem(ctx, id+".md")
+    }
+
+    u := c.buildURL("/notes/"+id, nil)
+
+    resp, err := c.send(ctx, http.MethodDelete, u, nil, nil)
+    if err != nil {
+        return fmt.Errorf("do DELETE: %w", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode == http.StatusNotFound {
+        return nil
+    }
+
+    if resp.StatusCode >= 300 {
+        bodyBytes, _ := io.ReadAll(resp.Body)
+        return fmt.Errorf("delete note failed: status=%d body=%s", resp.StatusCode, string(bodyBytes))
+    }
+
+    return nil
+}
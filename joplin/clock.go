@@ -0,0 +1,44 @@
+package joplin
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "net/http"
+    "time"
+)
+
+// ClockSkew estimates how far the local clock is from the Joplin host's clock, using the Date header of a
+// ping response. A positive result means the local clock is behind. The header has one-second resolution,
+// so skews below a few seconds are noise.
+func (c *Client) ClockSkew(ctx context.Context) (time.Duration, error) {
+    start := time.Now()
+
+    var resp *http.Response
+    var err error
+    if c.serverMode() {
+        resp, err = c.serverDo(ctx, http.MethodGet, "/api/ping", nil, "")
+    } else {
+        resp, err = c.get(ctx, c.buildURL("/ping", nil))
+    }
+    if err != nil {
+        return 0, err
+    }
+    defer resp.Body.Close()
+    io.Copy(io.Discard, resp.Body)
+
+    end := time.Now()
+
+    date := resp.Header.Get("Date")
+    if date == "" {
+        return 0, fmt.Errorf("ping response has no Date header")
+    }
+    serverTime, err := http.ParseTime(date)
+    if err != nil {
+        return 0, fmt.Errorf("parse Date header %q: %w", date, err)
+    }
+
+    // The server stamped the response somewhere between start and end; assume the middle.
+    local := start.Add(end.Sub(start) / 2)
+    return serverTime.Sub(local), nil
+}
@@ -0,0 +1,38 @@
+package joplin
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+    "log"
+    "reflect"
+)
+
+// decode reads a JSON response body into v. With StrictDecode set, the body is also decoded with
+// DisallowUnknownFields, and fields the client does not model are logged once per distinct message.
+// Unknown fields never fail the request, so strict mode only serves as an early warning for API changes.
+func (c *Client) decode(r io.Reader, v any) error {
+    if !c.StrictDecode {
+        return json.NewDecoder(r).Decode(v)
+    }
+
+    data, err := io.ReadAll(r)
+    if err != nil {
+        return err
+    }
+    if err := json.Unmarshal(data, v); err != nil {
+        return err
+    }
+
+    // Decode into a fresh value of the same type so v keeps the lenient result.
+    dec := json.NewDecoder(bytes.NewReader(data))
+    dec.DisallowUnknownFields()
+    if err := dec.Decode(reflect.New(reflect.TypeOf(v).Elem()).Interface()); err != nil {
+        msg := fmt.Sprintf("%T: %v", v, err)
+        if _, seen := c.strictWarned.LoadOrStore(msg, true); !seen {
+            log.Printf("WARNING: strict decode: Joplin returned data the client does not model (%s)", msg)
+        }
+    }
+    return nil
+}
@@ -0,0 +1,92 @@
+package joplin
+
+import (
+    "fmt"
+    "io"
+    "mime/multipart"
+    "net/textproto"
+)
+
+// resourceForm streams the multipart body of a resource upload from its source through a pipe, so a file
+// is never held in memory. Each call to open starts a new copy of the body for another attempt; a source
+// that is not an io.Seeker can only be sent once.
+type resourceForm struct {
+    src      io.Reader
+    opened   bool
+    boundary string
+    header   textproto.MIMEHeader
+    props    []byte
+
+    // pr and done belong to the copy in progress, if any.
+    pr   *io.PipeReader
+    done chan struct{}
+}
+
+func newResourceForm(src io.Reader, header textproto.MIMEHeader, props []byte) *resourceForm {
+    return &resourceForm{
+        src:      src,
+        boundary: multipart.NewWriter(io.Discard).Boundary(),
+        header:   header,
+        props:    props,
+    }
+}
+
+// contentType is the Content-Type header of the request.
+func (f *resourceForm) contentType() string {
+    return "multipart/form-data; boundary=" + f.boundary
+}
+
+// open stops the previous copy, rewinds the source and starts writing the body from the beginning.
+// Write errors reach the reader of the returned body through the pipe.
+func (f *resourceForm) open() (io.Reader, error) {
+    f.stop()
+    if seeker, ok := f.src.(io.Seeker); ok {
+        if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+            return nil, fmt.Errorf("rewind resource data: %w", err)
+        }
+    } else if f.opened {
+        return nil, fmt.Errorf("resource data cannot be read again for another attempt")
+    }
+    f.opened = true
+
+    pr, pw := io.Pipe()
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        pw.CloseWithError(f.write(pw))
+    }()
+    f.pr, f.done = pr, done
+    return pr, nil
+}
+
+// stop aborts the copy in progress, if any, and waits until it no longer reads the source.
+func (f *resourceForm) stop() {
+    if f.pr == nil {
+        return
+    }
+    f.pr.CloseWithError(io.ErrClosedPipe)
+    <-f.done
+    f.pr, f.done = nil, nil
+}
+
+func (f *resourceForm) write(w io.Writer) error {
+    writer := multipart.NewWriter(w)
+    if err := writer.SetBoundary(f.boundary); err != nil {
+        return err
+    }
+
+    fileField, err := writer.CreatePart(f.header)
+    if err != nil {
+        return fmt.Errorf("create form file: %w", err)
+    }
+    if _, err := io.Copy(fileField, f.src); err != nil {
+        return fmt.Errorf("copy file data: %w", err)
+    }
+    if err := writer.WriteField("props", string(f.props)); err != nil {
+        return fmt.Errorf("write props field: %w", err)
+    }
+    if err := writer.Close(); err != nil {
+        return fmt.Errorf("close multipart writer: %w", err)
+    }
+    return nil
+}
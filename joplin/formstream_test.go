@@ -0,0 +1,155 @@
+package joplin
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "io"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "runtime"
+    "sync/atomic"
+    "testing"
+)
+
+// patternReader yields n bytes of a repeating pattern without holding them, and is not an io.Seeker.
+type patternReader struct {
+    n, off int64
+}
+
+func (r *patternReader) Read(p []byte) (int, error) {
+    if r.off >= r.n {
+        return 0, io.EOF
+    }
+    p = p[:min(int64(len(p)), r.n-r.off)]
+    for i := range p {
+        p[i] = byte((r.off + int64(i)) % 251)
+    }
+    r.off += int64(len(p))
+    return len(p), nil
+}
+
+// streamingStub reads uploads part by part, recording the size and hash of the data part.
+func streamingStub(t *testing.T) (srv *httptest.Server, size *atomic.Int64, sum *atomic.Value) {
+    t.Helper()
+    size, sum = new(atomic.Int64), new(atomic.Value)
+    srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        mr, err := req.MultipartReader()
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        var n int64
+        var digest string
+        props := false
+        for {
+            part, err := mr.NextPart()
+            if err == io.EOF {
+                break
+            }
+            if err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+            }
+            switch part.FormName() {
+            case "data":
+                h := sha256.New()
+                n, _ = io.Copy(h, part)
+                digest = hex.EncodeToString(h.Sum(nil))
+            case "props":
+                props = true
+            }
+        }
+        if !props {
+            http.Error(w, "missing props", http.StatusBadRequest)
+            return
+        }
+        size.Store(n)
+        sum.Store(digest)
+        json.NewEncoder(w).Encode(Resource{ID: "0123456789abcdef0123456789abcdef", Size: n})
+    }))
+    t.Cleanup(srv.Close)
+    return srv, size, sum
+}
+
+func patternSHA256(n int64) string {
+    h := sha256.New()
+    io.Copy(h, &patternReader{n: n})
+    return hex.EncodeToString(h.Sum(nil))
+}
+
+// A large upload from a plain io.Reader is streamed: the stub receives every byte while the client
+// allocates only a small fraction of the upload size.
+func TestUploadResourceReaderStreams(t *testing.T) {
+    const n = 64 << 20
+    srv, size, sum := streamingStub(t)
+    c := NewClient(srv.URL, "token")
+
+    var before, after runtime.MemStats
+    runtime.GC()
+    runtime.ReadMemStats(&before)
+    if _, err := c.UploadResourceReader(context.Background(), &patternReader{n: n}, "big.bin", "", ""); err != nil {
+        t.Fatal(err)
+    }
+    runtime.ReadMemStats(&after)
+
+    if got := size.Load(); got != n {
+        t.Errorf("server received %d bytes, want %d", got, n)
+    }
+    if got := sum.Load(); got != patternSHA256(n) {
+        t.Errorf("server received different content")
+    }
+    // Client and stub share the process, so this bounds both; buffering the upload would allocate > n.
+    if alloc := after.TotalAlloc - before.TotalAlloc; alloc > n/4 {
+        t.Errorf("upload of %d bytes allocated %d bytes", n, alloc)
+    }
+}
+
+// dialFailFirst fails the first request with a connection error after consuming part of its body, so the
+// retry has to start the body over.
+type dialFailFirst struct {
+    failed atomic.Bool
+}
+
+func (d *dialFailFirst) RoundTrip(req *http.Request) (*http.Response, error) {
+    if !d.failed.Swap(true) {
+        io.CopyN(io.Discard, req.Body, 4096)
+        req.Body.Close()
+        return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+    }
+    return http.DefaultTransport.RoundTrip(req)
+}
+
+// A file is rewound and streamed again when an attempt fails; a plain reader cannot be, so it is not retried.
+func TestUploadResourceRetryRewinds(t *testing.T) {
+    const n = 1 << 20
+    path := filepath.Join(t.TempDir(), "data.bin")
+    f, err := os.Create(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := io.Copy(f, &patternReader{n: n}); err != nil {
+        t.Fatal(err)
+    }
+    f.Close()
+
+    srv, size, sum := streamingStub(t)
+    c := NewClient(srv.URL, "token", WithRetries(2), WithHTTPClient(&http.Client{Transport: &dialFailFirst{}}))
+    if _, err := c.UploadResource(context.Background(), path, ""); err != nil {
+        t.Fatal(err)
+    }
+    if size.Load() != n || sum.Load() != patternSHA256(n) {
+        t.Errorf("retried upload received %d bytes, want the complete file", size.Load())
+    }
+
+    srv, _, _ = streamingStub(t)
+    c = NewClient(srv.URL, "token", WithRetries(2), WithHTTPClient(&http.Client{Transport: &dialFailFirst{}}))
+    if _, err := c.UploadResourceReader(context.Background(), &patternReader{n: n}, "data.bin", "", ""); err == nil {
+        t.Error("a failed upload from a plain reader was retried with partial data")
+    }
+}
@@ -0,0 +1,30 @@
+package joplin
+
+import (
+    "fmt"
+    "io"
+    "mime"
+    "net/http"
+    "path/filepath"
+)
+
+// detectMime returns the MIME type of a file to upload: c.ResourceMime if set, else the type registered for
+// its extension, else the type sniffed from its first 512 bytes. f is left at its start.
+func (c *Client) detectMime(path string, f io.ReadSeeker) (string, error) {
+    if c.ResourceMime != "" {
+        return c.ResourceMime, nil
+    }
+    if t := mime.TypeByExtension(filepath.Ext(path)); t != "" {
+        return t, nil
+    }
+
+    head := make([]byte, 512)
+    n, err := io.ReadFull(f, head)
+    if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+        return "", fmt.Errorf("read file type: %w", err)
+    }
+    if _, err := f.Seek(0, io.SeekStart); err != nil {
+        return "", fmt.Errorf("rewind file: %w", err)
+    }
+    return http.DetectContentType(head[:n]), nil
+}
@@ -0,0 +1,51 @@
+package joplin
+
+import (
+    "io"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func TestDetectMime(t *testing.T) {
+    zip := "PK\x03\x04\x14\x00\x00\x00\x08\x00"
+    pdf := "%PDF-1.7\n%\xe2\xe3\xcf\xd3\n"
+    tests := []struct {
+        name     string
+        content  string
+        override string
+        want     string
+    }{
+        // SimpleMind maps are zip archives with an extension no MIME table knows.
+        {"map.smmx", zip, "", "application/zip"},
+        {"doc.pdf", pdf, "", "application/pdf"},
+        {"doc.pdf", "not really a pdf", "", "application/pdf"},
+        {"scan.unknownext", pdf, "", "application/pdf"},
+        {"notes.unknownext", "plain text", "", "text/plain; charset=utf-8"},
+        {"map.smmx", zip, "application/x-smmx", "application/x-smmx"},
+    }
+    for _, tt := range tests {
+        path := filepath.Join(t.TempDir(), tt.name)
+        if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+            t.Fatal(err)
+        }
+        f, err := os.Open(path)
+        if err != nil {
+            t.Fatal(err)
+        }
+        c := NewClient("http://localhost", "token")
+        c.ResourceMime = tt.override
+        got, err := c.detectMime(path, f)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if got != tt.want {
+            t.Errorf("detectMime(%s, override %q) = %q, want %q", tt.name, tt.override, got, tt.want)
+        }
+        // The upload reads the file from its start afterwards.
+        if data, _ := io.ReadAll(f); string(data) != tt.content {
+            t.Errorf("%s: file not rewound", tt.name)
+        }
+        f.Close()
+    }
+}
@@ -0,0 +1,130 @@
+package joplin
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "strings"
+)
+
+type Folder struct {
+    ID       string `json:"id"`
+    Title    string `json:"title"`
+    ParentID string `json:"parent_id"`
+}
+
+type FoldersResponse = ListResponse[Folder]
+
+// Folders returns all notebooks (folders) as a flat list; nesting is expressed by ParentID.
+func (c *Client) Folders(ctx context.Context) ([]Folder, error) {
+    if c.serverMode() {
+        return nil, fmt.Errorf("list notebooks: %w", ErrServerModeUnsupported)
+    }
+
+    return paginate[Folder](ctx, c, "/folders", "id,title,parent_id", "notebooks")
+}
+
+// Folder returns a single notebook by ID. A missing notebook yields an error wrapping ErrNotFound.
+func (c *Client) Folder(ctx context.Context, id string) (*Folder, error) {
+    if c.serverMode() {
+        return nil, fmt.Errorf("get notebook: %w", ErrServerModeUnsupported)
+    }
+
+    u := c.buildURL("/folders/"+id, map[string]string{"fields": "id,title,parent_id"})
+    resp, err := c.get(ctx, u)
+    if err != nil {
+        return nil, fmt.Errorf("get notebook: %w", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode == http.StatusNotFound {
+        return nil, fmt.Errorf("get notebook %s: %w", id, ErrNotFound)
+    }
+    if resp.StatusCode >= 300 {
+        bodyBytes, _ := io.ReadAll(resp.Body)
+        return nil, fmt.Errorf("get notebook failed: status=%d body=%s", resp.StatusCode, string(bodyBytes))
+    }
+
+    var folder Folder
+    if err := c.decode(resp.Body, &folder); err != nil {
+        return nil, fmt.Errorf("decode notebook: %w", err)
+    }
+
+    return &folder, nil
+}
+
+// FolderIDByName returns the ID of the notebook whose title matches name case-insensitively.
+// Zero or several matching notebooks are an error, the latter listing the candidate IDs.
+func (c *Client) FolderIDByName(ctx context.Context, name string) (string, error) {
+    return c.ChildFolderIDByName(ctx, name, "")
+}
+
+// ChildFolderIDByName is FolderIDByName restricted to the direct children of parentID, if set.
+func (c *Client) ChildFolderIDByName(ctx context.Context, name, parentID string) (string, error) {
+    folders, err := c.Folders(ctx)
+    if err != nil {
+        return "", err
+    }
+
+    var ids []string
+    for _, f := range folders {
+        if strings.EqualFold(f.Title, name) && (parentID == "" || f.ParentID == parentID) {
+            ids = append(ids, f.ID)
+        }
+    }
+    switch len(ids) {
+    case 0:
+        return "", fmt.Errorf("notebook %q: %w", name, ErrNotFound)
+    case 1:
+        return ids[0], nil
+    default:
+        return "", fmt.Errorf("%d notebooks are named %q (%s); pass --notebook_id instead", len(ids), name, strings.Join(ids, ", "))
+    }
+}
+
+// CreateFolder creates a notebook (folder) like CreateNotebook and returns only its ID.
+func (c *Client) CreateFolder(ctx context.Context, title, parentID string) (string, error) {
+    folder, err := c.CreateNotebook(ctx, title, parentID)
+    if err != nil {
+        return "", err
+    }
+    return folder.ID, nil
+}
+
+// CreateNotebook creates a notebook; an empty parentID creates a top-level notebook.
+func (c *Client) CreateNotebook(ctx context.Context, title, parentID string) (*Folder, error) {
+    if c.serverMode() {
+        return nil, fmt.Errorf("create notebook: %w", ErrServerModeUnsupported)
+    }
+
+    payload := map[string]string{"title": title}
+    if parentID != "" {
+        payload["parent_id"] = parentID
+    }
+    data, err := json.Marshal(payload)
+    if err != nil {
+        return nil, fmt.Errorf("marshal notebook: %w", err)
+    }
+
+    u := c.buildURL("/folders", nil)
+    resp, err := c.post(ctx, u, "application/json", bytes.NewReader(data))
+    if err != nil {
+        return nil, fmt.Errorf("post notebook: %w", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode >= 300 {
+        bodyBytes, _ := io.ReadAll(resp.Body)
+        return nil, fmt.Errorf("create notebook failed: status=%d body=%s", resp.StatusCode, string(bodyBytes))
+    }
+
+    var folder Folder
+    if err := c.decode(resp.Body, &folder); err != nil {
+        return nil, fmt.Errorf("decode notebook: %w", err)
+    }
+
+    return &folder, nil
+}
@@ -0,0 +1,31 @@
+package joplin
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestCreateFolder(t *testing.T) {
+    var got map[string]string
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        if req.Method != http.MethodPost || req.URL.Path != "/folders" {
+            http.NotFound(w, req)
+            return
+        }
+        json.NewDecoder(req.Body).Decode(&got)
+        json.NewEncoder(w).Encode(Folder{ID: "f1", Title: got["title"], ParentID: got["parent_id"]})
+    }))
+    defer srv.Close()
+    c := NewClient(srv.URL, "token")
+
+    id, err := c.CreateFolder(context.Background(), "Backups", "p1")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if id != "f1" || got["title"] != "Backups" || got["parent_id"] != "p1" {
+        t.Errorf("CreateFolder = %q with payload %v, want f1 with title Backups under p1", id, got)
+    }
+}
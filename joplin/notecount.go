@@ -0,0 +1,25 @@
+package joplin
+
+import "context"
+
+// NoteCount returns the number of notes in the notebook (folder), counting every note including
+// notes that share a title.
+func (c *Client) NoteCount(ctx context.Context, notebookId string) (int, error) {
+    if c.serverMode() {
+        multi, err := c.serverNotesByTitle(ctx, notebookId)
+        if err != nil {
+            return 0, err
+        }
+        count := 0
+        for _, notes := range multi {
+            count += len(notes)
+        }
+        return count, nil
+    }
+
+    notes, err := paginate[Note](ctx, c, "/folders/"+notebookId+"/notes", "id", "notes")
+    if err != nil {
+        return 0, err
+    }
+    return len(notes), nil
+}
@@ -0,0 +1,25 @@
+package joplin
+
+// FileLimiter bounds the number of source files open at the same time, so concurrent uploads cannot
+// exhaust the process's file descriptors. A nil limiter is unlimited.
+type FileLimiter struct {
+    sem chan struct{}
+}
+
+// NewFileLimiter returns a limiter allowing n open files; n <= 0 means unlimited (nil limiter).
+func NewFileLimiter(n int) *FileLimiter {
+    if n <= 0 {
+        return nil
+    }
+    return &FileLimiter{sem: make(chan struct{}, n)}
+}
+
+// Acquire blocks until a file may be opened and returns the function that frees the slot again;
+// call it after the file is closed.
+func (l *FileLimiter) Acquire() func() {
+    if l == nil {
+        return func() {}
+    }
+    l.sem <- struct{}{}
+    return func() { <-l.sem }
+}
@@ -0,0 +1,54 @@
+package joplin
+
+import (
+    "net/http"
+    "time"
+)
+
+// ClientOption configures a Client created by NewClient.
+type ClientOption func(*Client)
+
+// WithHTTPClient makes the client send its requests through hc, e.g. one with a custom transport or proxy.
+// hc is never modified; a WithTimeout given in any position applies to a copy of it.
+func WithHTTPClient(hc *http.Client) ClientOption {
+    return func(c *Client) {
+        c.HTTP = hc
+    }
+}
+
+// WithTimeout bounds every request including reading the response body; 0 disables the limit.
+// It is applied after all other options, so it is not lost to a later WithHTTPClient.
+func WithTimeout(timeout time.Duration) ClientOption {
+    return func(c *Client) {
+        c.timeout = &timeout
+    }
+}
+
+// WithRetries sets how many times a transient failure (connection error, 429, 5xx) is retried. Requests
+// that create an item are only retried when the connection could not be established.
+func WithRetries(retries int) ClientOption {
+    return func(c *Client) {
+        c.Retries = retries
+    }
+}
+
+// WithRate limits the client to perSecond requests per second, allowing a burst of one; 0 means unlimited.
+func WithRate(perSecond float64) ClientOption {
+    return func(c *Client) {
+        c.Limiter = NewRateLimiter(perSecond, 1)
+    }
+}
+
+// WithBearerAuth sends the token in an "Authorization: Bearer" header instead of the token query parameter.
+func WithBearerAuth() ClientOption {
+    return func(c *Client) {
+        c.BearerAuth = true
+    }
+}
+
+// WithUserAgent sets the User-Agent header of every request (default: Go's).
+func WithUserAgent(userAgent string) ClientOption {
+    return func(c *Client) {
+        c.UserAgent = userAgent
+    }
+}
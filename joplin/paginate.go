@@ -0,0 +1,56 @@
+package joplin
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "strconv"
+)
+
+// ListResponse is one page of a Data API list endpoint.
+type ListResponse[T any] struct {
+    Items   []T  `json:"items"`
+    HasMore bool `json:"has_more"`
+}
+
+// paginate fetches every page of the list endpoint at path, requesting the given fields, and returns the
+// items of all pages in order. what names the items in errors, e.g. "note tags".
+func paginate[T any](ctx context.Context, c *Client, path, fields, what string) ([]T, error) {
+    var result []T
+    page := 1
+
+    for {
+        params := map[string]string{
+            "page":   strconv.Itoa(page),
+            "fields": fields,
+        }
+        u := c.buildURL(path, params)
+
+        resp, err := c.get(ctx, u)
+        if err != nil {
+            return nil, fmt.Errorf("fetch %s page %d: %w", what, page, err)
+        }
+
+        if resp.StatusCode >= 300 {
+            bodyBytes, _ := io.ReadAll(resp.Body)
+            resp.Body.Close()
+            return nil, fmt.Errorf("list %s failed: status=%d body=%s", what, resp.StatusCode, string(bodyBytes))
+        }
+
+        var payload ListResponse[T]
+        if err := c.decode(resp.Body, &payload); err != nil {
+            resp.Body.Close()
+            return nil, fmt.Errorf("decode %s page %d: %w", what, page, err)
+        }
+        resp.Body.Close()
+
+        result = append(result, payload.Items...)
+
+        if !payload.HasMore {
+            break
+        }
+        page++
+    }
+
+    return result, nil
+}
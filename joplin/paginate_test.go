@@ -0,0 +1,46 @@
+package joplin
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestPaginate(t *testing.T) {
+    pages := map[string]ListResponse[Tag]{
+        "1": {Items: []Tag{{ID: "a"}, {ID: "b"}}, HasMore: true},
+        "2": {Items: []Tag{{ID: "c"}}, HasMore: true},
+        "3": {Items: []Tag{}},
+    }
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        if req.URL.Path != "/tags" || req.URL.Query().Get("fields") != "id,title" {
+            http.NotFound(w, req)
+            return
+        }
+        page, ok := pages[req.URL.Query().Get("page")]
+        if !ok {
+            http.Error(w, "no such page", http.StatusBadRequest)
+            return
+        }
+        json.NewEncoder(w).Encode(page)
+    }))
+    defer srv.Close()
+    c := NewClient(srv.URL, "token", WithRetries(0))
+
+    tags, err := c.Tags(context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+    if want := []Tag{{ID: "a"}, {ID: "b"}, {ID: "c"}}; !reflect.DeepEqual(tags, want) {
+        t.Errorf("Tags = %+v, want %+v", tags, want)
+    }
+
+    _, err = paginate[Tag](context.Background(), c, "/missing", "id", "widgets")
+    if err == nil || !strings.HasPrefix(err.Error(), "list widgets failed: status=404") {
+        t.Errorf("paginate error = %v, want a list widgets status error", err)
+    }
+}
@@ -0,0 +1,58 @@
+package joplin
+
+import (
+    "context"
+    "sync"
+    "time"
+)
+
+// RateLimiter spaces requests evenly so a large run does not flood Joplin's local HTTP server, allowing
+// bursts of up to burst requests after an idle period (a token bucket). A nil limiter is unlimited.
+type RateLimiter struct {
+    mu       sync.Mutex
+    interval time.Duration
+    burst    int
+    // next is when the bucket will hold a token again; tokens accrued while idle are bounded by burst.
+    next time.Time
+}
+
+// NewRateLimiter returns a limiter allowing perSecond requests per second; perSecond <= 0 means unlimited
+// (nil limiter).
+func NewRateLimiter(perSecond float64, burst int) *RateLimiter {
+    if perSecond <= 0 {
+        return nil
+    }
+    return &RateLimiter{
+        interval: time.Duration(float64(time.Second) / perSecond),
+        burst:    max(1, burst),
+    }
+}
+
+// wait blocks until the next request may be sent, or returns ctx's error if ctx ends first.
+func (l *RateLimiter) wait(ctx context.Context) error {
+    if l == nil {
+        return nil
+    }
+
+    l.mu.Lock()
+    now := time.Now()
+    if earliest := now.Add(-time.Duration(l.burst-1) * l.interval); l.next.Before(earliest) {
+        l.next = earliest
+    }
+    at := l.next
+    l.next = l.next.Add(l.interval)
+    l.mu.Unlock()
+
+    delay := at.Sub(now)
+    if delay <= 0 {
+        return nil
+    }
+    t := time.NewTimer(delay)
+    defer t.Stop()
+    select {
+    case <-ctx.Done():
+        return ctx.Err()
+    case <-t.C:
+        return nil
+    }
+}
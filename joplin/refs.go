@@ -0,0 +1,24 @@
+package joplin
+
+import (
+    "context"
+    "fmt"
+)
+
+// AllResources returns every resource in the Joplin profile (resources do not belong to a notebook).
+func (c *Client) AllResources(ctx context.Context) ([]Resource, error) {
+    if c.serverMode() {
+        return nil, fmt.Errorf("list resources: %w", ErrServerModeUnsupported)
+    }
+
+    return paginate[Resource](ctx, c, "/resources", "id,title,size", "resources")
+}
+
+// ResourceNotes returns the notes, in any notebook, that reference a resource (GET /resources/:id/notes).
+func (c *Client) ResourceNotes(ctx context.Context, resourceID string) ([]Note, error) {
+    if c.serverMode() {
+        return nil, fmt.Errorf("list resource notes: %w", ErrServerModeUnsupported)
+    }
+
+    return paginate[Note](ctx, c, "/resources/"+resourceID+"/notes", "id,title", "resource notes")
+}
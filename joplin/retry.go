@@ -0,0 +1,192 @@
+package joplin
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "math/rand/v2"
+    "net"
+    "net/http"
+    "net/url"
+    "os"
+    "strings"
+    "sync/atomic"
+    "time"
+)
+
+// ErrRetryBudgetExhausted is returned once the run-wide retry budget has been used up.
+var ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+// RetryBudget caps the total number of retries across all requests of a run, so a systemic
+// outage fails fast instead of every request exhausting its own retries.
+type RetryBudget struct {
+    remaining atomic.Int64
+}
+
+// NewRetryBudget returns a budget of n retries; n <= 0 means unlimited (nil budget).
+func NewRetryBudget(n int) *RetryBudget {
+    if n <= 0 {
+        return nil
+    }
+    b := &RetryBudget{}
+    b.remaining.Store(int64(n))
+    return b
+}
+
+// take consumes one retry and reports whether it was available.
+// A nil budget is unlimited.
+func (b *RetryBudget) take() bool {
+    if b == nil {
+        return true
+    }
+    return b.remaining.Add(-1) >= 0
+}
+
+const (
+    retryBaseDelay = 500 * time.Millisecond
+    retryMaxDelay  = 30 * time.Second
+)
+
+// retryDelay returns the backoff before retry number attempt+1: exponential, capped at retryMaxDelay,
+// with the upper half randomized so clients failing together do not retry in lockstep.
+func retryDelay(attempt int) time.Duration {
+    delay := retryBaseDelay << attempt
+    if delay > retryMaxDelay || delay <= 0 {
+        delay = retryMaxDelay
+    }
+    return delay/2 + rand.N(delay/2+1)
+}
+
+// send performs an HTTP request, retrying transient failures (connection errors, 429 and 5xx; see retryable)
+// up to c.Retries times with jittered exponential backoff. body, if non-nil, is rewound before every attempt.
+func (c *Client) send(ctx context.Context, method, u string, body io.ReadSeeker, header http.Header) (*http.Response, error) {
+    var open func() (io.Reader, error)
+    if body != nil {
+        open = func() (io.Reader, error) {
+            if _, err := body.Seek(0, io.SeekStart); err != nil {
+                return nil, fmt.Errorf("rewind request body: %w", err)
+            }
+            return body, nil
+        }
+    }
+    return c.sendBody(ctx, method, u, open, header)
+}
+
+// sendBody is send with a request body produced by open, which is called before every attempt and must
+// return the complete body each time; a nil open sends no body. It lets bodies be streamed instead of
+// held in memory.
+// After an attempt timed out, the next one gets c.HTTP.Timeout multiplied by c.TimeoutBackoff (if > 1),
+// since a large upload that timed out usually needs more time rather than another identical try.
+// Retries are logged by method and path only, since the query string carries the token.
+func (c *Client) sendBody(ctx context.Context, method, u string, open func() (io.Reader, error), header http.Header) (*http.Response, error) {
+    httpClient := c.HTTP
+    for attempt := 0; ; attempt++ {
+        var reqBody io.Reader
+        if open != nil {
+            var err error
+            if reqBody, err = open(); err != nil {
+                return nil, err
+            }
+        }
+
+        req, err := http.NewRequestWithContext(ctx, method, u, reqBody)
+        if err != nil {
+            return nil, fmt.Errorf("new %s request: %w", method, err)
+        }
+        if c.UserAgent != "" {
+            req.Header.Set("User-Agent", c.UserAgent)
+        }
+        if c.BearerAuth && c.Token != "" {
+            req.Header.Set("Authorization", "Bearer "+c.Token)
+        }
+        for k, v := range header {
+            req.Header[k] = v
+        }
+
+        if err := c.Limiter.wait(ctx); err != nil {
+            return nil, err
+        }
+        resp, err := httpClient.Do(req)
+        if !retryable(ctx, req, resp, err) {
+            return resp, err
+        }
+        if attempt >= c.Retries {
+            if attempt > 0 {
+                log.Printf("ERROR %s %s failed after %d attempts: %v", method, req.URL.Path, attempt+1, attemptError(resp, err))
+            }
+            return resp, err
+        }
+
+        lastErr := attemptError(resp, err)
+        if resp != nil {
+            io.Copy(io.Discard, resp.Body)
+            resp.Body.Close()
+        }
+
+        if !c.Budget.take() {
+            return nil, fmt.Errorf("%w (last error: %v)", ErrRetryBudgetExhausted, lastErr)
+        }
+
+        delay := retryDelay(attempt)
+        log.Printf("WARNING: %s %s failed (attempt %d of %d): %v; retrying in %s",
+            method, req.URL.Path, attempt+1, c.Retries+1, lastErr, delay.Round(time.Millisecond))
+        if isTimeout(err) && c.TimeoutBackoff > 1 && httpClient.Timeout > 0 {
+            longer := *httpClient
+            longer.Timeout = time.Duration(float64(httpClient.Timeout) * c.TimeoutBackoff)
+            httpClient = &longer
+            log.Printf("WARNING: %s %s timed out; next attempt gets a %s timeout", method, req.URL.Path, httpClient.Timeout.Round(time.Millisecond))
+        }
+        select {
+        case <-ctx.Done():
+            return nil, ctx.Err()
+        case <-time.After(delay):
+        }
+    }
+}
+
+// attemptError describes a failed attempt: the transport error without its URL, or the HTTP status.
+func attemptError(resp *http.Response, err error) error {
+    if err != nil {
+        if ue, ok := err.(*url.Error); ok {
+            return ue.Err
+        }
+        return err
+    }
+    return fmt.Errorf("status=%d", resp.StatusCode)
+}
+
+// isTimeout reports whether a request failed because it ran out of time, as opposed to e.g. a refused connection.
+func isTimeout(err error) bool {
+    return err != nil && (errors.Is(err, context.DeadlineExceeded) || os.IsTimeout(err))
+}
+
+// retryable reports whether a request outcome is worth another attempt. A POST that creates an item is
+// only retried when the connection could not be established: Joplin may have committed a request that
+// failed afterwards, and sending it again would create a duplicate note, resource or tag.
+func retryable(ctx context.Context, req *http.Request, resp *http.Response, err error) bool {
+    if err != nil && ctx.Err() != nil {
+        // Cancellation is deliberate, not transient.
+        return false
+    }
+    if !idempotent(req) {
+        return err != nil && isDialError(err)
+    }
+    if err != nil {
+        return true
+    }
+    return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// idempotent reports whether sending req twice has the same effect as sending it once. That holds for
+// every method but POST, and for the Joplin Server login (POST /api/sessions).
+func idempotent(req *http.Request) bool {
+    return req.Method != http.MethodPost || strings.HasSuffix(req.URL.Path, "/api/sessions")
+}
+
+// isDialError reports whether a request failed before it was sent, while connecting to the server.
+func isDialError(err error) bool {
+    var opErr *net.OpError
+    return errors.As(err, &opErr) && opErr.Op == "dial"
+}
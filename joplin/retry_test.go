@@ -0,0 +1,79 @@
+package joplin
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "testing"
+)
+
+func TestCreateNoteNotRetriedAfterCommit(t *testing.T) {
+    var mu sync.Mutex
+    notes := 0
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        if req.Method != http.MethodPost || req.URL.Path != "/notes" {
+            http.NotFound(w, req)
+            return
+        }
+        // The note is stored, but the response is lost on the way back, as behind a failing proxy.
+        mu.Lock()
+        notes++
+        mu.Unlock()
+        http.Error(w, "bad gateway", http.StatusBadGateway)
+    }))
+    defer srv.Close()
+    c := NewClient(srv.URL, "token", WithRetries(3))
+
+    if _, err := c.CreateNote(context.Background(), "nb", "map.smmx", "body", NoteOptions{}); err == nil {
+        t.Fatal("CreateNote succeeded on a 502")
+    }
+    mu.Lock()
+    defer mu.Unlock()
+    if notes != 1 {
+        t.Errorf("%d notes created, want 1", notes)
+    }
+}
+
+func TestGetRetriedOnServerError(t *testing.T) {
+    var mu sync.Mutex
+    attempts := 0
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        mu.Lock()
+        attempts++
+        first := attempts == 1
+        mu.Unlock()
+        if first {
+            http.Error(w, "bad gateway", http.StatusBadGateway)
+            return
+        }
+        json.NewEncoder(w).Encode(Note{ID: "n1", Title: "map.smmx"})
+    }))
+    defer srv.Close()
+    c := NewClient(srv.URL, "token", WithRetries(3))
+
+    note, err := c.GetNote(context.Background(), "n1")
+    if err != nil {
+        t.Fatalf("GetNote: %v", err)
+    }
+    if note.ID != "n1" || attempts != 2 {
+        t.Errorf("GetNote = %+v after %d attempts, want n1 after 2", note, attempts)
+    }
+}
+
+func TestPostRetriedOnDialError(t *testing.T) {
+    srv := httptest.NewServer(http.NotFoundHandler())
+    u := srv.URL
+    srv.Close()
+    c := NewClient(u, "token", WithRetries(1))
+
+    req, _ := http.NewRequest(http.MethodPost, u+"/notes", nil)
+    _, err := c.HTTP.Do(req)
+    if err == nil {
+        t.Fatal("request to a closed server succeeded")
+    }
+    if !retryable(context.Background(), req, nil, err) {
+        t.Errorf("dial error %v not retryable for POST", err)
+    }
+}
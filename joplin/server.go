@@ -0,0 +1,520 @@
+package joplin
+
+import (
+    "bytes"
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Joplin item types, as stored in the "type_" property of serialized items.
+const (
+    itemTypeNote     = 1
+    itemTypeResource = 4
+)
+
+// ErrServerModeUnsupported is returned by client methods that have no Joplin Server equivalent.
+var ErrServerModeUnsupported = errors.New("not supported in server mode")
+
+// serverTimeLayout is the timestamp format used by Joplin's sync serialization.
+const serverTimeLayout = "2006-01-02T15:04:05.000Z"
+
+// Login authenticates against Joplin Server and switches the client into server mode.
+// All subsequent calls go to the Joplin Server items API using the session token.
+func (c *Client) Login(ctx context.Context, email, password string) error {
+    payload := map[string]string{
+        "email":    email,
+        "password": password,
+    }
+    data, err := json.Marshal(payload)
+    if err != nil {
+        return fmt.Errorf("marshal login: %w", err)
+    }
+
+    resp, err := c.post(ctx, c.BaseURL+"/api/sessions", "application/json", bytes.NewReader(data))
+    if err != nil {
+        return fmt.Errorf("post session: %w", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode >= 300 {
+        bodyBytes, _ := io.ReadAll(resp.Body)
+        return fmt.Errorf("login failed: status=%d body=%s", resp.StatusCode, string(bodyBytes))
+    }
+
+    var session struct {
+        ID string `json:"id"`
+    }
+    if err := c.decode(resp.Body, &session); err != nil {
+        return fmt.Errorf("decode session: %w", err)
+    }
+    if session.ID == "" {
+        return fmt.Errorf("login failed: empty session id")
+    }
+
+    c.SessionID = session.ID
+    return nil
+}
+
+// serverMode reports whether the client talks to Joplin Server instead of the Web Clipper API.
+func (c *Client) serverMode() bool {
+    return c.SessionID != ""
+}
+
+// serverItemPath returns the API path of an item stored under the sync root.
+func serverItemPath(name string) string {
+    return "/api/items/root:/" + name + ":"
+}
+
+// serverDo sends an authenticated request to Joplin Server.
+func (c *Client) serverDo(ctx context.Context, method, path string, body io.ReadSeeker, contentType string) (*http.Response, error) {
+    header := http.Header{"X-Api-Auth": {c.SessionID}}
+    if contentType != "" {
+        header.Set("Content-Type", contentType)
+    }
+
+    resp, err := c.send(ctx, method, c.BaseURL+path, body, header)
+    if err != nil {
+        return nil, fmt.Errorf("do %s: %w", method, err)
+    }
+    return resp, nil
+}
+
+// serverGetItem downloads the raw content of an item.
+func (c *Client) serverGetItem(ctx context.Context, name string) ([]byte, error) {
+    resp, err := c.serverDo(ctx, http.MethodGet, serverItemPath(name)+"/content", nil, "")
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode == http.StatusNotFound {
+        return nil, fmt.Errorf("get item %s: %w", name, ErrNotFound)
+    }
+    if resp.StatusCode >= 300 {
+        bodyBytes, _ := io.ReadAll(resp.Body)
+        return nil, fmt.Errorf("get item %s failed: status=%d body=%s", name, resp.StatusCode, string(bodyBytes))
+    }
+
+    return io.ReadAll(resp.Body)
+}
+
+// serverPutItem creates or replaces the content of an item.
+func (c *Client) serverPutItem(ctx context.Context, name string, content io.ReadSeeker) error {
+    resp, err := c.serverDo(ctx, http.MethodPut, serverItemPath(name)+"/content", content, "application/octet-stream")
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode >= 300 {
+        bodyBytes, _ := io.ReadAll(resp.Body)
+        return fmt.Errorf("put item %s failed: status=%d body=%s", name, resp.StatusCode, string(bodyBytes))
+    }
+
+    return nil
+}
+
+// serverDeleteItem deletes an item; a missing item is not an error.
+func (c *Client) serverDeleteItem(ctx context.Context, name string) error {
+    resp, err := c.serverDo(ctx, http.MethodDelete, serverItemPath(name), nil, "")
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode == http.StatusNotFound {
+        return nil
+    }
+
+    if resp.StatusCode >= 300 {
+        bodyBytes, _ := io.ReadAll(resp.Body)
+        return fmt.Errorf("delete item %s failed: status=%d body=%s", name, resp.StatusCode, string(bodyBytes))
+    }
+
+    return nil
+}
+
+// serverPing checks that Joplin Server is reachable and returns its /api/ping response body.
+func (c *Client) serverPing(ctx context.Context) (string, error) {
+    resp, err := c.serverDo(ctx, http.MethodGet, "/api/ping", nil, "")
+    if err != nil {
+        return "", err
+    }
+    defer resp.Body.Close()
+    body, err := io.ReadAll(resp.Body)
+    if resp.StatusCode != http.StatusOK {
+        return "", fmt.Errorf("ping failed: status=%d body=%s", resp.StatusCode, string(body))
+    }
+    if err != nil {
+        return "", fmt.Errorf("read ping response: %w", err)
+    }
+    return strings.TrimSpace(string(body)), nil
+}
+
+// serverNotesByTitle lists the sync root and returns the notes whose parent is the notebook.
+// Joplin Server stores every item as a serialized ".md" file, so each one has to be downloaded
+// and parsed to find out its type and parent.
+func (c *Client) serverNotesByTitle(ctx context.Context, notebookId string) (map[string][]Note, error) {
+    result := make(map[string][]Note)
+    cursor := ""
+
+    for {
+        path := serverItemPath("") + "/children"
+        if cursor != "" {
+            path += "?cursor=" + url.QueryEscape(cursor)
+        }
+
+        resp, err := c.serverDo(ctx, http.MethodGet, path, nil, "")
+        if err != nil {
+            return nil, fmt.Errorf("list items: %w", err)
+        }
+
+        if resp.StatusCode >= 300 {
+            bodyBytes, _ := io.ReadAll(resp.Body)
+            resp.Body.Close()
+            return nil, fmt.Errorf("list items failed: status=%d body=%s", resp.StatusCode, string(bodyBytes))
+        }
+
+        var payload struct {
+            Items []struct {
+                Name string `json:"name"`
+            } `json:"items"`
+            HasMore bool   `json:"has_more"`
+            Cursor  string `json:"cursor"`
+        }
+        if err := c.decode(resp.Body, &payload); err != nil {
+            resp.Body.Close()
+            return nil, fmt.Errorf("decode items: %w", err)
+        }
+        resp.Body.Close()
+
+        for _, item := range payload.Items {
+            if !strings.HasSuffix(item.Name, ".md") || strings.Contains(item.Name, "/") {
+                continue
+            }
+
+            data, err := c.serverGetItem(ctx, item.Name)
+            if err != nil {
+                return nil, err
+            }
+
+            title, body, props := unserializeItem(string(data))
+            if props["type_"] != strconv.Itoa(itemTypeNote) || props["parent_id"] != notebookId {
+                continue
+            }
+
+            note := Note{ID: props["id"], Title: title, Body: body}
+            if t, err := time.Parse(serverTimeLayout, props["updated_time"]); err == nil {
+                note.UpdatedTime = t.UnixMilli()
+            }
+            if t, err := time.Parse(serverTimeLayout, props["created_time"]); err == nil {
+                note.CreatedTime = t.UnixMilli()
+            }
+            result[title] = append(result[title], note)
+        }
+
+        if !payload.HasMore || payload.Cursor == "" {
+            break
+        }
+        cursor = payload.Cursor
+    }
+
+    return result, nil
+}
+
+// serverUploadResource stores the file blob and its resource metadata item.
+func (c *Client) serverUploadResource(ctx context.Context, path, title string) (*Resource, error) {
+    release := c.OpenFiles.Acquire()
+    defer release()
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, fmt.Errorf("open file: %w", err)
+    }
+    defer f.Close()
+
+    info, err := f.Stat()
+    if err != nil {
+        return nil, fmt.Errorf("stat file: %w", err)
+    }
+    mimeType, err := c.detectMime(path, f)
+    if err != nil {
+        return nil, err
+    }
+
+    id, err := newItemID()
+    if err != nil {
+        return nil, err
+    }
+
+    if err := c.serverPutItem(ctx, ".resource/"+id, f); err != nil {
+        return nil, fmt.Errorf("upload resource blob: %w", err)
+    }
+
+    ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+    now := time.Now().UTC().Format(serverTimeLayout)
+
+    meta := serializeItem(resourceTitle(path, title), "", [][2]string{
+        {"id", id},
+        {"mime", mimeType},
+        {"filename", ""},
+        {"created_time", now},
+        {"updated_time", now},
+        {"user_created_time", now},
+        {"user_updated_time", now},
+        {"file_extension", ext},
+        {"encryption_cipher_text", ""},
+        {"encryption_applied", "0"},
+        {"encryption_blob_encrypted", "0"},
+        {"size", strconv.FormatInt(info.Size(), 10)},
+        {"is_shared", "0"},
+        {"share_id", ""},
+        {"master_key_id", ""},
+        {"user_data", ""},
+        {"blob_updated_time", strconv.FormatInt(time.Now().UnixMilli(), 10)},
+        {"type_", strconv.Itoa(itemTypeResource)},
+    })
+
+    if err := c.serverPutItem(ctx, id+".md", strings.NewReader(meta)); err != nil {
+        // Do not leave an unreferenced blob behind.
+        _ = c.serverDeleteItem(ctx, ".resource/"+id)
+        return nil, fmt.Errorf("upload resource metadata: %w", err)
+    }
+
+    return &Resource{ID: id, Title: resourceTitle(path, title)}, nil
+}
+
+// serverResource reads the resource metadata item.
+func (c *Client) serverResource(ctx context.Context, id string) (*Resource, error) {
+    data, err := c.serverGetItem(ctx, id+".md")
+    if err != nil {
+        return nil, err
+    }
+
+    title, _, props := unserializeItem(string(data))
+    size, _ := strconv.ParseInt(props["size"], 10, 64)
+    res := &Resource{
+        ID:            props["id"],
+        Title:         title,
+        Size:          size,
+        Mime:          props["mime"],
+        FileExtension: props["file_extension"],
+    }
+    if t, err := time.Parse(serverTimeLayout, props["created_time"]); err == nil {
+        res.CreatedTime = t.UnixMilli()
+    }
+    if t, err := time.Parse(serverTimeLayout, props["updated_time"]); err == nil {
+        res.UpdatedTime = t.UnixMilli()
+    }
+    return res, nil
+}
+
+// serverGetNote downloads and parses a single note item.
+func (c *Client) serverGetNote(ctx context.Context, id string) (*Note, error) {
+    data, err := c.serverGetItem(ctx, id+".md")
+    if err != nil {
+        return nil, err
+    }
+
+    title, body, props := unserializeItem(string(data))
+    if props["type_"] != strconv.Itoa(itemTypeNote) {
+        return nil, fmt.Errorf("item %s is not a note: %w", id, ErrNotFound)
+    }
+
+    note := &Note{ID: props["id"], Title: title, Body: body}
+    if t, err := time.Parse(serverTimeLayout, props["updated_time"]); err == nil {
+        note.UpdatedTime = t.UnixMilli()
+    }
+    return note, nil
+}
+
+// serverDeleteResource removes both the resource metadata item and its blob.
+func (c *Client) serverDeleteResource(ctx context.Context, id string) error {
+    if err := c.serverDeleteItem(ctx, id+".md"); err != nil {
+        return err
+    }
+    return c.serverDeleteItem(ctx, ".resource/"+id)
+}
+
+// serverUserTime formats a NoteOptions timestamp (Unix milliseconds) for an item, or returns fallback if it is unset.
+func serverUserTime(ms int64, fallback string) string {
+    if ms == 0 {
+        return fallback
+    }
+    return time.UnixMilli(ms).UTC().Format(serverTimeLayout)
+}
+
+// serverCreateNote stores a new note item in the notebook.
+func (c *Client) serverCreateNote(ctx context.Context, notebookId, title, body string, opts NoteOptions) (*Note, error) {
+    id, err := newItemID()
+    if err != nil {
+        return nil, err
+    }
+    now := time.Now().UTC().Format(serverTimeLayout)
+
+    content := serializeItem(title, body, [][2]string{
+        {"id", id},
+        {"parent_id", notebookId},
+        {"created_time", now},
+        {"updated_time", now},
+        {"is_conflict", "0"},
+        {"latitude", "0.00000000"},
+        {"longitude", "0.00000000"},
+        {"altitude", "0.0000"},
+        {"author", ""},
+        {"source_url", ""},
+        {"is_todo", "0"},
+        {"todo_due", "0"},
+        {"todo_completed", "0"},
+        {"source", "go-joplin-file-backup"},
+        {"source_application", "go-joplin-file-backup"},
+        {"application_data", ""},
+        {"order", strconv.FormatInt(opts.Order, 10)},
+        {"user_created_time", serverUserTime(opts.UserCreatedTime, now)},
+        {"user_updated_time", serverUserTime(opts.UserUpdatedTime, now)},
+        {"encryption_cipher_text", ""},
+        {"encryption_applied", "0"},
+        {"markup_language", "1"},
+        {"is_shared", "0"},
+        {"share_id", ""},
+        {"conflict_original_id", ""},
+        {"master_key_id", ""},
+        {"user_data", ""},
+        {"deleted_time", "0"},
+        {"type_", strconv.Itoa(itemTypeNote)},
+    })
+
+    if err := c.serverPutItem(ctx, id+".md", strings.NewReader(content)); err != nil {
+        return nil, fmt.Errorf("create note: %w", err)
+    }
+
+    return &Note{ID: id, Title: title, Body: body}, nil
+}
+
+// serverUpdateNote rewrites an existing note item, keeping all properties it does not manage.
+func (c *Client) serverUpdateNote(ctx context.Context, id, notebookId, title, body string, opts NoteOptions) error {
+    data, err := c.serverGetItem(ctx, id+".md")
+    if err != nil {
+        return fmt.Errorf("load note: %w", err)
+    }
+
+    _, _, existing := unserializeItem(string(data))
+    now := time.Now().UTC().Format(serverTimeLayout)
+
+    props := make([][2]string, 0, len(existing))
+    for _, key := range orderedKeys(string(data)) {
+        value := existing[key]
+        switch key {
+        case "parent_id":
+            value = notebookId
+        case "updated_time":
+            value = now
+        case "user_updated_time":
+            value = serverUserTime(opts.UserUpdatedTime, now)
+        case "user_created_time":
+            if opts.UserCreatedTime != 0 {
+                value = serverUserTime(opts.UserCreatedTime, now)
+            }
+        case "order":
+            if opts.Order != 0 {
+                value = strconv.FormatInt(opts.Order, 10)
+            }
+        }
+        props = append(props, [2]string{key, value})
+    }
+
+    content := serializeItem(title, body, props)
+    if err := c.serverPutItem(ctx, id+".md", strings.NewReader(content)); err != nil {
+        return fmt.Errorf("update note: %w", err)
+    }
+
+    return nil
+}
+
+// serializeItem renders an item in Joplin's sync format: the title, the body and a
+// trailing block of "key: value" properties, separated by blank lines.
+func serializeItem(title, body string, props [][2]string) string {
+    lines := make([]string, 0, len(props))
+    for _, p := range props {
+        value := strings.ReplaceAll(p[1], "\n", "\\n")
+        value = strings.ReplaceAll(value, "\r", "\\r")
+        lines = append(lines, p[0]+": "+value)
+    }
+
+    parts := []string{title}
+    if body != "" {
+        parts = append(parts, body)
+    }
+    parts = append(parts, strings.Join(lines, "\n"))
+    return strings.Join(parts, "\n\n")
+}
+
+// unserializeItem parses an item in Joplin's sync format.
+func unserializeItem(data string) (title, body string, props map[string]string) {
+    props = make(map[string]string)
+    lines := strings.Split(data, "\n")
+
+    i := len(lines) - 1
+    for ; i >= 0; i-- {
+        line := strings.TrimSpace(lines[i])
+        if line == "" {
+            break
+        }
+        key, value, ok := strings.Cut(line, ":")
+        if !ok {
+            continue
+        }
+        value = strings.TrimSpace(value)
+        value = strings.ReplaceAll(value, "\\n", "\n")
+        value = strings.ReplaceAll(value, "\\r", "\r")
+        props[strings.TrimSpace(key)] = value
+    }
+
+    if i <= 0 {
+        return "", "", props
+    }
+
+    rest := lines[:i]
+    title = rest[0]
+    if len(rest) > 2 {
+        body = strings.Join(rest[2:], "\n")
+    }
+    return title, body, props
+}
+
+// orderedKeys returns the property keys of a serialized item in their original order.
+func orderedKeys(data string) []string {
+    lines := strings.Split(data, "\n")
+
+    var keys []string
+    for i := len(lines) - 1; i >= 0; i-- {
+        line := strings.TrimSpace(lines[i])
+        if line == "" {
+            break
+        }
+        if key, _, ok := strings.Cut(line, ":"); ok {
+            keys = append([]string{strings.TrimSpace(key)}, keys...)
+        }
+    }
+    return keys
+}
+
+// newItemID returns a random 32-char hex ID, the format Joplin uses for all items.
+func newItemID() (string, error) {
+    b := make([]byte, 16)
+    if _, err := rand.Read(b); err != nil {
+        return "", fmt.Errorf("generate item id: %w", err)
+    }
+    return hex.EncodeToString(b), nil
+}
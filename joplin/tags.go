@@ -0,0 +1,114 @@
+package joplin
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "strings"
+)
+
+type Tag struct {
+    ID    string `json:"id"`
+    Title string `json:"title"`
+}
+
+type TagsResponse = ListResponse[Tag]
+
+// Tags returns all tags defined in Joplin.
+func (c *Client) Tags(ctx context.Context) ([]Tag, error) {
+    if c.serverMode() {
+        return nil, fmt.Errorf("list tags: %w", ErrServerModeUnsupported)
+    }
+
+    return paginate[Tag](ctx, c, "/tags", "id,title", "tags")
+}
+
+// NoteTags returns the tags attached to a note.
+func (c *Client) NoteTags(ctx context.Context, noteID string) ([]Tag, error) {
+    if c.serverMode() {
+        return nil, fmt.Errorf("list note tags: %w", ErrServerModeUnsupported)
+    }
+
+    return paginate[Tag](ctx, c, "/notes/"+noteID+"/tags", "id,title", "note tags")
+}
+
+// CreateTag creates a new tag with the given title.
+func (c *Client) CreateTag(ctx context.Context, title string) (*Tag, error) {
+    if c.serverMode() {
+        return nil, fmt.Errorf("create tag: %w", ErrServerModeUnsupported)
+    }
+
+    data, err := json.Marshal(map[string]string{"title": title})
+    if err != nil {
+        return nil, fmt.Errorf("marshal tag: %w", err)
+    }
+
+    u := c.buildURL("/tags", nil)
+    resp, err := c.post(ctx, u, "application/json", bytes.NewReader(data))
+    if err != nil {
+        return nil, fmt.Errorf("post tag: %w", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode >= 300 {
+        bodyBytes, _ := io.ReadAll(resp.Body)
+        return nil, fmt.Errorf("create tag failed: status=%d body=%s", resp.StatusCode, string(bodyBytes))
+    }
+
+    var tag Tag
+    if err := c.decode(resp.Body, &tag); err != nil {
+        return nil, fmt.Errorf("decode tag: %w", err)
+    }
+
+    return &tag, nil
+}
+
+// EnsureTag returns the ID of the tag with the given title (matched case-insensitively, as Joplin stores
+// tag titles in lower case), creating the tag if it does not exist. It lists all tags on every call, so
+// callers tagging many notes should cache the IDs.
+func (c *Client) EnsureTag(ctx context.Context, title string) (string, error) {
+    tags, err := c.Tags(ctx)
+    if err != nil {
+        return "", err
+    }
+    for _, t := range tags {
+        if strings.EqualFold(t.Title, title) {
+            return t.ID, nil
+        }
+    }
+
+    tag, err := c.CreateTag(ctx, strings.ToLower(title))
+    if err != nil {
+        return "", err
+    }
+    return tag.ID, nil
+}
+
+// TagNote attaches a tag to a note.
+// Joplin treats tagging an already-tagged note as a no-op, so this is safe to repeat.
+func (c *Client) TagNote(ctx context.Context, tagID, noteID string) error {
+    if c.serverMode() {
+        return fmt.Errorf("tag note: %w", ErrServerModeUnsupported)
+    }
+
+    data, err := json.Marshal(map[string]string{"id": noteID})
+    if err != nil {
+        return fmt.Errorf("marshal tag note: %w", err)
+    }
+
+    u := c.buildURL("/tags/"+tagID+"/notes", nil)
+    resp, err := c.post(ctx, u, "application/json", bytes.NewReader(data))
+    if err != nil {
+        return fmt.Errorf("post tag note: %w", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode >= 300 {
+        bodyBytes, _ := io.ReadAll(resp.Body)
+        return fmt.Errorf("tag note failed: status=%d body=%s", resp.StatusCode, string(bodyBytes))
+    }
+
+    return nil
+}
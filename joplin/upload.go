@@ -0,0 +1,112 @@
+package joplin
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "net/textproto"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// UploadResource uploads a file as a Joplin resource and returns its metadata.
+func (c *Client) UploadResource(ctx context.Context, path, title string) (*Resource, error) {
+    if c.serverMode() {
+        return c.serverUploadResource(ctx, path, title)
+    }
+
+    release := c.OpenFiles.Acquire()
+    defer release()
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, fmt.Errorf("open file: %w", err)
+    }
+    defer f.Close()
+
+    mimeType, err := c.detectMime(path, f)
+    if err != nil {
+        return nil, err
+    }
+    filename := strings.ToValidUTF8(filepath.Base(path), "\uFFFD")
+    return c.UploadResourceReader(ctx, f, filename, resourceTitle(path, title), mimeType)
+}
+
+// formQuoteEscaper escapes a multipart form file name like multipart.Writer.CreateFormFile does.
+var formQuoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// UploadResourceReader uploads the content read from r as a new resource, for data that is not a file
+// on disk (e.g. transformed or encrypted bytes). filename is the name Joplin records for the upload;
+// an empty title falls back to it. An empty mimeType lets Joplin detect the type from the file name.
+// The content is streamed, never held in memory. An io.ReadSeeker (such as an *os.File) is rewound for
+// retries; any other reader can only be sent once, so a failed attempt is not retried. Not supported in
+// server mode.
+func (c *Client) UploadResourceReader(ctx context.Context, r io.Reader, filename, title, mimeType string) (*Resource, error) {
+    if c.serverMode() {
+        return nil, fmt.Errorf("upload resource from reader: %w", ErrServerModeUnsupported)
+    }
+
+    if title == "" {
+        title = resourceTitle(filename, "")
+    }
+    if filename == "" {
+        // A part without a file name is a plain form field, not an upload.
+        filename = title
+    }
+
+    // Same header as multipart.Writer.CreateFormFile, plus a caller-chosen Content-Type.
+    partHeader := make(textproto.MIMEHeader)
+    partHeader.Set("Content-Disposition", fmt.Sprintf(`form-data; name="data"; filename="%s"`, formQuoteEscaper.Replace(filename)))
+    partHeader.Set("Content-Type", "application/octet-stream")
+    if mimeType != "" {
+        partHeader.Set("Content-Type", mimeType)
+    }
+
+    props := map[string]string{"title": title, "mime": mimeType}
+    // Joplin may reject empty values, so only send fields that are set.
+    for k, v := range props {
+        if v == "" {
+            delete(props, k)
+        }
+    }
+    propsJSON, err := json.Marshal(props)
+    if err != nil {
+        return nil, fmt.Errorf("marshal props: %w", err)
+    }
+
+    form := newResourceForm(r, partHeader, propsJSON)
+    defer form.stop()
+
+    u := c.buildURL("/resources", nil)
+    resp, err := c.sendBody(ctx, http.MethodPost, u, form.open, http.Header{"Content-Type": {form.contentType()}})
+    if err != nil {
+        return nil, fmt.Errorf("do request: %w", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode >= 300 {
+        body, _ := io.ReadAll(resp.Body)
+        return nil, fmt.Errorf("upload resource failed: status=%d body=%s", resp.StatusCode, string(body))
+    }
+
+    var res Resource
+    if err := c.decode(resp.Body, &res); err != nil {
+        return nil, fmt.Errorf("decode resource: %w", err)
+    }
+
+    return &res, nil
+}
+
+// resourceTitle returns the title to store on a resource, falling back to the file name
+// and then to a placeholder so the upload never carries an empty title.
+func resourceTitle(path, title string) string {
+    if title != "" {
+        return title
+    }
+    if base := strings.ToValidUTF8(filepath.Base(path), "\uFFFD"); base != "." && base != string(filepath.Separator) {
+        return base
+    }
+    return "untitled"
+}
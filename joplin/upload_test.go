@@ -0,0 +1,94 @@
+package joplin
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+// uploadStub accepts resource uploads like the Data API and records the last one.
+type uploadStub struct {
+    *httptest.Server
+    data  []byte
+    props map[string]string
+}
+
+func newUploadStub(t *testing.T) *uploadStub {
+    t.Helper()
+    s := &uploadStub{}
+    s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        if req.Method != http.MethodPost || req.URL.Path != "/resources" {
+            http.NotFound(w, req)
+            return
+        }
+        f, _, err := req.FormFile("data")
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        s.data, _ = io.ReadAll(f)
+        s.props = nil
+        if err := json.Unmarshal([]byte(req.FormValue("props")), &s.props); err != nil {
+            http.Error(w, "bad props: "+err.Error(), http.StatusBadRequest)
+            return
+        }
+        if title, ok := s.props["title"]; ok && title == "" {
+            http.Error(w, "empty title", http.StatusBadRequest)
+            return
+        }
+        json.NewEncoder(w).Encode(Resource{ID: "0123456789abcdef0123456789abcdef", Title: s.props["title"], Size: int64(len(s.data))})
+    }))
+    t.Cleanup(s.Close)
+    return s
+}
+
+func TestUploadResourceEmptyTitle(t *testing.T) {
+    s := newUploadStub(t)
+    c := NewClient(s.URL, "token")
+
+    path := filepath.Join(t.TempDir(), "map.smmx")
+    if err := os.WriteFile(path, []byte("mind map"), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    res, err := c.UploadResource(context.Background(), path, "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if res.Title != "map.smmx" || s.props["title"] != "map.smmx" {
+        t.Errorf("title = %q (props %v), want the file name", res.Title, s.props)
+    }
+
+    // Without a file name either, the placeholder is sent.
+    if _, err := c.UploadResourceReader(context.Background(), bytes.NewReader([]byte("x")), "", "", ""); err != nil {
+        t.Fatal(err)
+    }
+    if s.props["title"] != "untitled" {
+        t.Errorf("props = %v, want title untitled", s.props)
+    }
+    if _, ok := s.props["mime"]; ok {
+        t.Errorf("props = %v, want no empty mime", s.props)
+    }
+}
+
+func TestUploadResourceReaderFromBytes(t *testing.T) {
+    s := newUploadStub(t)
+    c := NewClient(s.URL, "token", WithRetries(0))
+
+    data := []byte("in-memory content")
+    res, err := c.UploadResourceReader(context.Background(), bytes.NewReader(data), "notes.txt", "My notes", "text/plain")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if res.Size != int64(len(data)) || !bytes.Equal(s.data, data) {
+        t.Errorf("server received %q (resource size %d), want %q", s.data, res.Size, data)
+    }
+    if s.props["title"] != "My notes" || s.props["mime"] != "text/plain" {
+        t.Errorf("props = %v", s.props)
+    }
+}
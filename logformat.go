@@ -0,0 +1,70 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "io"
+    "strings"
+    "sync"
+    "time"
+)
+
+// logRecord is one message in --log_format=json output.
+type logRecord struct {
+    Time  string `json:"time"`
+    Level string `json:"level"`
+    Msg   string `json:"msg"`
+}
+
+// jsonLineWriter turns every line written to it into a logRecord on w. It is used as the output of the
+// log package and of r.out, so all existing messages switch format without changes at the call sites.
+// The level comes from the message's "ERROR" or "WARNING:" prefix.
+type jsonLineWriter struct {
+    mu      sync.Mutex
+    w       io.Writer
+    pending []byte
+}
+
+func newJSONLineWriter(w io.Writer) *jsonLineWriter {
+    return &jsonLineWriter{w: w}
+}
+
+// Write buffers partial lines until their newline arrives; each complete line is written as one record.
+func (j *jsonLineWriter) Write(p []byte) (int, error) {
+    j.mu.Lock()
+    defer j.mu.Unlock()
+
+    j.pending = append(j.pending, p...)
+    for {
+        i := bytes.IndexByte(j.pending, '\n')
+        if i < 0 {
+            return len(p), nil
+        }
+        line := string(j.pending[:i])
+        j.pending = j.pending[i+1:]
+        if strings.TrimSpace(line) == "" {
+            continue
+        }
+        if err := j.writeRecord(line); err != nil {
+            return len(p), err
+        }
+    }
+}
+
+func (j *jsonLineWriter) writeRecord(line string) error {
+    rec := logRecord{Time: time.Now().UTC().Format(time.RFC3339Nano), Level: "info", Msg: strings.TrimSpace(line)}
+    switch {
+    case strings.HasPrefix(rec.Msg, "ERROR"):
+        rec.Level = "error"
+        rec.Msg = strings.TrimLeft(strings.TrimPrefix(rec.Msg, "ERROR"), ": ")
+    case strings.HasPrefix(rec.Msg, "WARNING"):
+        rec.Level = "warning"
+        rec.Msg = strings.TrimLeft(strings.TrimPrefix(rec.Msg, "WARNING"), ": ")
+    }
+    data, err := json.Marshal(rec)
+    if err != nil {
+        return err
+    }
+    _, err = j.w.Write(append(data, '\n'))
+    return err
+}
@@ -1,468 +1,1861 @@
 package main
 
 import (
-    "bytes"
+    "context"
     "encoding/json"
+    "errors"
     "flag"
     "fmt"
     "io"
+    "io/fs"
     "log"
-    "mime/multipart"
-    "net/http"
+    "mime"
     "net/url"
     "os"
+    "os/signal"
     "path/filepath"
+    "slices"
     "strconv"
     "strings"
+    "sync"
+    "sync/atomic"
     "syscall"
+    "text/template"
     "time"
+
+    "github.com/volodymyroliinyk/go-joplin-file-backup/joplin"
 )
 
-type Client struct {
-    BaseURL string
-    Token   string
-    HTTP    *http.Client
-}
+// resourceIDLength is the length of a Joplin item ID: 32 hex characters.
+const resourceIDLength = 32
+
+// extractResourceIDs searches for all resource IDs referenced as ":/RESOURCE_ID", whatever the surrounding
+// syntax: markdown links [name](:/RESOURCE_ID) as well as HTML attributes such as <img src=":/RESOURCE_ID">.
+// Only the 32 hex characters of the ID are taken, so links like (:/ID "title") or (:/ID#anchor) yield
+// the bare ID; references whose target is not an ID are ignored.
+func extractResourceIDs(body string) []string {
+    var ids []string
+    start := 0
+
+    for {
+        i := strings.Index(body[start:], ":/")
+        if i == -1 {
+            break
+        }
+        i += start
+
+        // resource starts after ":/"
+        idStart := i + len(":/")
+        j := idStart
+        for j < len(body) && isHexDigit(body[j]) {
+            j++
+        }
+
+        if j-idStart == resourceIDLength {
+            ids = append(ids, body[idStart:j])
+        }
 
-type Note struct {
-    ID    string `json:"id"`
-    Title string `json:"title"`
-    Body  string `json:"body,omitempty"`
+        start = j
+    }
+
+    return ids
 }
 
-type NotesResponse struct {
-    Items   []Note `json:"items"`
-    HasMore bool   `json:"has_more"`
+func isHexDigit(c byte) bool {
+    return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
 }
 
-type Resource struct {
-    ID    string `json:"id"`
-    Title string `json:"title"`
+// staleResources returns the resource IDs in oldIDs that newBody no longer links to.
+func staleResources(oldIDs []string, newBody string) []string {
+    keep := make(map[string]bool)
+    for _, id := range extractResourceIDs(newBody) {
+        keep[id] = true
+    }
+
+    var stale []string
+    for _, id := range oldIDs {
+        if !keep[id] {
+            keep[id] = true
+            stale = append(stale, id)
+        }
+    }
+    return stale
 }
 
-const (
-    JOPLIN_API_BASE = "http://localhost:41184"
-    // JOPLIN_TOKEN    = "ac41d362cc994227eec2b01c2a4f1b3a925eb20d742202f3480e516e68a916dcef7717225ba1e452a37600a48fd7fdb2c2e50b84f0659b2047ad2050cd91d289"
-)
+// fileCreatedAt returns the "earliest" timestamp available for the file:
+// min(modTime, atime, ctime) on Unix; on other OS falls back to ModTime().
+func fileCreatedAt(info os.FileInfo) time.Time {
+    t := info.ModTime()
+
+    if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+        // Unix-like systems: use atime, mtime, ctime and take the earliest.
+        atime := time.Unix(int64(stat.Atim.Sec), int64(stat.Atim.Nsec))
+        mtime := time.Unix(int64(stat.Mtim.Sec), int64(stat.Mtim.Nsec))
+        ctime := time.Unix(int64(stat.Ctim.Sec), int64(stat.Ctim.Nsec))
 
-func NewClient(baseURL, token string) *Client {
-    return &Client{
-        BaseURL: strings.TrimRight(baseURL, "/"),
-        Token:   token,
-        HTTP:    &http.Client{Timeout: 15 * time.Second},
+        t = mtime
+        if atime.Before(t) {
+            t = atime
+        }
+        if ctime.Before(t) {
+            t = ctime
+        }
     }
+
+    return t
 }
 
-// buildURL adds path and query parameters, including token.
-func (c *Client) buildURL(path string, params map[string]string) string {
-    if !strings.HasPrefix(path, "/") {
-        path = "/" + path
+// withinRoot resolves symlinks in path and reports whether the real target lies inside root.
+// root must already be resolved with filepath.EvalSymlinks.
+func withinRoot(root, path string) (bool, error) {
+    real, err := filepath.EvalSymlinks(path)
+    if err != nil {
+        return false, err
     }
-    u, err := url.Parse(c.BaseURL)
+    rel, err := filepath.Rel(root, real)
     if err != nil {
-        // fallback, shouldn't normally happen
-        return c.BaseURL + path
+        return false, nil
+    }
+    if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+        return false, nil
     }
-    u.Path = strings.TrimRight(u.Path, "/") + path
+    return true, nil
+}
 
-    q := u.Query()
-    if c.Token != "" {
-        q.Set("token", c.Token)
+// parseSince parses --since: an RFC 3339 timestamp, or a duration counted back from now.
+// An empty value yields the zero time, i.e. no cutoff.
+func parseSince(s string, now time.Time) (time.Time, error) {
+    s = strings.TrimSpace(s)
+    if s == "" {
+        return time.Time{}, nil
     }
-    for k, v := range params {
-        q.Set(k, v)
+    if t, err := time.Parse(time.RFC3339, s); err == nil {
+        return t, nil
     }
-    u.RawQuery = q.Encode()
-    return u.String()
+    d, err := time.ParseDuration(s)
+    if err != nil {
+        return time.Time{}, fmt.Errorf("%q is neither an RFC 3339 time nor a duration", s)
+    }
+    if d < 0 {
+        return time.Time{}, fmt.Errorf("duration %q must not be negative", s)
+    }
+    return now.Add(-d), nil
 }
 
-func (c *Client) Ping() error {
-    u := c.buildURL("/ping", nil)
-    resp, err := c.HTTP.Get(u)
+// readTokenFile reads the API token from a file such as a mounted secret or a systemd credential,
+// ignoring surrounding whitespace and the trailing newline.
+func readTokenFile(path string) (string, error) {
+    path, err := expandPath(path)
     if err != nil {
-        return err
+        return "", err
     }
-    defer resp.Body.Close()
-    if resp.StatusCode != http.StatusOK {
-        body, _ := io.ReadAll(resp.Body)
-        return fmt.Errorf("ping failed: status=%d body=%s", resp.StatusCode, string(body))
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return "", err
     }
-    return nil
+    token := strings.TrimSpace(string(data))
+    if token == "" {
+        return "", fmt.Errorf("%s is empty", path)
+    }
+    return token, nil
 }
 
-// NotesByTitle returns all notes in the notebook (folder) as a map[title]Note.
-func (c *Client) NotesByTitle(notebookId string) (map[string]Note, error) {
-    result := make(map[string]Note)
-    page := 1
+// expandPath expands $VAR / ${VAR} references and a leading "~" in a path flag, for schedulers
+// (cron, systemd) that do not run the command line through a shell.
+func expandPath(p string) (string, error) {
+    p = os.ExpandEnv(p)
+    if p == "~" || strings.HasPrefix(p, "~/") {
+        home, err := os.UserHomeDir()
+        if err != nil {
+            return "", fmt.Errorf("expand ~ in %q: %w", p, err)
+        }
+        p = filepath.Join(home, strings.TrimPrefix(p, "~"))
+    }
+    return p, nil
+}
 
-    for {
-        params := map[string]string{
-            "page":   strconv.Itoa(page),
-            "fields": "id,title,body",
+// fileResult describes the outcome of backing up a single file.
+type fileResult struct {
+    Path         string `json:"path"`
+    Title        string `json:"title"`
+    Status       string `json:"status"`
+    NoteID       string `json:"note_id,omitempty"`
+    ResourceID   string `json:"resource_id,omitempty"`
+    SHA256       string `json:"sha256,omitempty"`
+    Size         int64  `json:"size"`
+    CreatedAtUTC string `json:"created_at_utc"`
+    Error        string `json:"error,omitempty"`
+
+    err error
+    // modTime is the file's modification time when it was processed, recorded in --state_file.
+    modTime time.Time
+    // resourcesDeleted counts the old resources removed after the note was updated.
+    resourcesDeleted int
+}
+
+// fail marks the result as errored.
+func (res *fileResult) fail(err error) {
+    res.Status = "error"
+    res.Error = err.Error()
+    res.err = err
+}
+
+// runner holds the state shared by all files processed during a run.
+type runner struct {
+    client *joplin.Client
+    // started is when the process started, for the elapsed time in the summary.
+    started time.Time
+    // lazyBodies lists notebooks without note bodies; bodies are fetched when a file matches (--lazy_bodies).
+    lazyBodies   bool
+    root         string
+    notebookId   string
+    notesByTitle map[string]joplin.Note
+
+    // mirrorTree places each file in a sub-notebook chain matching its directory.
+    mirrorTree bool
+    // maxNotebookDepth caps the sub-notebook chain (0 = unlimited); deeper levels are flattened
+    // into the note title, or abort the run when abortOnMaxDepth is set.
+    maxNotebookDepth int
+    abortOnMaxDepth  bool
+    // folders and notebookIDs (relative dir -> notebook ID) are loaded on first use in mirror-tree mode.
+    folders     []joplin.Folder
+    notebookIDs map[string]string
+    // notebookNotes caches the notes of sub-notebooks; the root notebook uses notesByTitle.
+    notebookNotes map[string]map[string]joplin.Note
+    // cacheMu guards the note, notebook and tag caches while files are processed concurrently.
+    cacheMu sync.Mutex
+    // titleLocks serializes the files that map to the same note (notebook ID and title), from the
+    // lookup in the note cache until the created or updated note is cached, so concurrent workers
+    // cannot both miss the cache and create the note twice.
+    titleLocks keyedMutex
+
+    // companionExts are the extensions of files attached to the note of the file with the same base name
+    // (--companion_extensions); empty without companions.
+    companionExts extensionSet
+    // bodyTemplate, if set, renders note bodies instead of the metadata lines (--body_template).
+    bodyTemplate *template.Template
+    // out receives the human-readable progress lines, one per file rendered with outputTemplate.
+    out            io.Writer
+    outputTemplate *template.Template
+    // stream, when set, receives one JSON object per processed file (NDJSON).
+    stream *json.Encoder
+    // jsonLog (--log_format=json) replaces the per-file status lines with the stream records.
+    jsonLog bool
+
+    // fsyncState makes every local state write durable (see writeStateFile).
+    fsyncState bool
+
+    // sidecarSuffix, when set, names the file (path+suffix) whose content becomes the note body.
+    sidecarSuffix string
+
+    // autoTagByExtension tags every note with its file extension (e.g. "pdf").
+    autoTagByExtension bool
+    // tag, when set, is a tag applied to every backed up note (--tag).
+    tag string
+    // tagIDs caches tag title -> ID; nil until the first lookup.
+    tagIDs map[string]string
+
+    // contentAddressed titles notes "<sha256> <name>" and never updates an existing note.
+    contentAddressed bool
+
+    // perFileTimeout bounds the whole upload/create/update/cleanup sequence of one file (0 = no limit).
+    perFileTimeout time.Duration
+
+    // repair re-uploads unchanged files whose linked resource size differs from the recorded size_bytes.
+    repair bool
+
+    // orderByCreated sets each note's manual sort position from the file's creation time.
+    orderByCreated bool
+
+    // onlyIfChanged leaves a note untouched when its recorded sha256 matches the file.
+    onlyIfChanged bool
+
+    // indexTitle, when set, is the title of a note that links to every other note in the notebook.
+    indexTitle string
+
+    // cleanupSem bounds the number of concurrent resource deletions across the run.
+    cleanupSem chan struct{}
+
+    // onUnreadable is the --on_unreadable policy: skip, warn or fail.
+    onUnreadable string
+
+    // vanishedPaths lists paths removed during the scan; rescanning is set while they are walked again.
+    vanishedPaths []string
+    rescanning    bool
+
+    // sidecarIDs binds files to notes through <file>.joplin ID sidecars.
+    sidecarIDs bool
+
+    // skipConflicts leaves notes edited in Joplin since the last run untouched (--on_conflict=skip).
+    skipConflicts bool
+
+    // verify fails files whose uploaded resource has a different size in Joplin; verifySize re-uploads
+    // them instead.
+    verify     bool
+    verifySize bool
+
+    // twoPhase confirms each upload before writing the note and rolls the resource back on failure.
+    twoPhase        bool
+    twoPhaseTimeout time.Duration
+
+    // externalizeAbove (bytes, 0 = off) moves larger files to externalStore instead of Joplin.
+    externalizeAbove int64
+    externalStore    string
+    externalURLBase  string
+
+    // preview reports what would happen to each file without uploading or writing anything;
+    // showDiff additionally prints the note bodies that would change.
+    preview  bool
+    showDiff bool
+
+    // stateFile is the --state_file path; state holds its content during a backup run, and resumeDone
+    // the files an interrupted previous run already finished.
+    stateFile    string
+    state        *runState
+    resumeDone   map[string]bool
+    stateSavedAt time.Time
+    stateDirty   bool
+    // stateLock holds the lock on the state file for the whole run; see lockRunState.
+    stateLock *os.File
+    // trustMtime skips hashing files whose size and mtime match prevFiles, the records of earlier runs.
+    trustMtime bool
+    prevFiles  map[string]fileRecord
+
+    // git, when set, is the git state of the scanned directory recorded in every note (--include_git).
+    git *gitInfo
+
+    // titleMap maps files (relative path or base name) to custom note titles.
+    titleMap map[string]string
+
+    // uniqueResourceTitles numbers a new resource's title when the note already has one with that title.
+    uniqueResourceTitles bool
+
+    // stopping is set by the shutdown handler; no new files are started once it is true.
+    stopping atomic.Bool
+    stats    runStats
+}
+
+// runStats counts per-file outcomes of a run.
+type runStats struct {
+    Processed int `json:"processed"`
+    Added     int `json:"added"`
+    Updated   int `json:"updated"`
+    Unchanged int `json:"unchanged"`
+    Errors    int `json:"errors"`
+    // Unreadable counts files and directories skipped because they could not be read.
+    Unreadable int `json:"unreadable"`
+    // Vanished counts files and directories removed while the scan was running (and not found again by a re-scan).
+    Vanished int `json:"vanished"`
+    // Conflicts counts notes left untouched because they were edited in Joplin (--on_conflict=skip).
+    Conflicts int `json:"conflicts"`
+    // ResourcesDeleted counts old resources removed after note updates and with pruned notes.
+    ResourcesDeleted int `json:"resources_deleted"`
+}
+
+// print writes a one-line summary of the counters.
+func (s runStats) print(w io.Writer, prefix string) {
+    fmt.Fprintf(w, "%s: processed=%d added=%d updated=%d unchanged=%d errors=%d unreadable=%d vanished=%d conflicts=%d resources_deleted=%d\n", prefix, s.Processed, s.Added, s.Updated, s.Unchanged, s.Errors, s.Unreadable, s.Vanished, s.Conflicts, s.ResourcesDeleted)
+}
+
+// summaryRecord is the end-of-run summary in --log_format=json output.
+type summaryRecord struct {
+    Summary string `json:"summary"`
+    runStats
+    ElapsedSeconds float64 `json:"elapsed_seconds"`
+}
+
+// summary prints the run's counters and wall-clock time, as one JSON record with --log_format=json.
+func (r *runner) summary(prefix string) {
+    elapsed := time.Since(r.started)
+    if r.jsonLog {
+        rec := summaryRecord{Summary: prefix, runStats: r.stats, ElapsedSeconds: elapsed.Seconds()}
+        if err := r.stream.Encode(rec); err != nil {
+            log.Printf("WARNING: failed to write json summary: %v", err)
         }
-        u := c.buildURL("/folders/"+notebookId+"/notes", params)
+        return
+    }
+    r.stats.print(r.out, prefix)
+    fmt.Fprintf(r.out, "Elapsed: %s\n", elapsed.Round(time.Millisecond))
+}
+
+// vanished records a file or directory that was removed between being listed and being read.
+// Its path is remembered for the optional re-scan after the walk.
+func (r *runner) vanished(path string, err error) {
+    r.stats.Vanished++
+    log.Printf("WARNING: %s vanished during the scan, not backed up: %v", path, err)
+    if !r.rescanning {
+        r.vanishedPaths = append(r.vanishedPaths, path)
+    }
+}
 
-        resp, err := c.HTTP.Get(u)
+// errUnreadable aborts the walk when --on_unreadable=fail.
+var errUnreadable = errors.New("unreadable path")
+
+// errFailFast aborts the walk at the first failed file when --fail_fast is set.
+var errFailFast = errors.New("file failed")
+
+// unreadable applies the --on_unreadable policy to a file or directory that could not be read.
+// It returns a non-nil error only when the run must abort.
+func (r *runner) unreadable(path string, err error) error {
+    r.stats.Unreadable++
+    switch r.onUnreadable {
+    case "fail":
+        return fmt.Errorf("%w: %s: %v", errUnreadable, path, err)
+    case "warn":
+        log.Printf("WARNING: not backed up, cannot read %s: %v", path, err)
+    default:
+        log.Printf("walk error on %s: %v", path, err)
+    }
+    return nil
+}
+
+// processFile uploads a single file and creates or updates its note.
+func (r *runner) processFile(ctx context.Context, path string, info os.FileInfo) fileResult {
+    if r.perFileTimeout > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, r.perFileTimeout)
+        defer cancel()
+        defer func() {
+            if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+                log.Printf("ERROR: %s exceeded --per_file_timeout (%s), moving on", path, r.perFileTimeout)
+            }
+        }()
+    }
+
+    createdAt := fileCreatedAt(info)
+    name, nameFixed := sanitizeUTF8(info.Name())
+    if _, pathFixed := sanitizeUTF8(path); nameFixed || pathFixed {
+        log.Printf("WARNING: %q is not valid UTF-8; invalid bytes are replaced with U+FFFD in the note", path)
+    }
+
+    result := fileResult{
+        Path:         path,
+        Title:        name,
+        CreatedAtUTC: createdAt.UTC().Format(time.RFC3339Nano),
+    }
+
+    var err error
+    notebookID := r.notebookId
+    title := r.noteTitle(path, name)
+    result.Title = title
+    if r.mirrorTree {
+        var titlePrefix string
+        notebookID, titlePrefix, err = r.notebookFor(ctx, path)
+        title = titlePrefix + title
+        result.Title = title
         if err != nil {
-            return nil, fmt.Errorf("fetch notes page %d: %w", page, err)
+            log.Printf("ERROR resolving notebook for %s: %v", path, err)
+            result.fail(err)
+            return result
         }
+    }
+    notes, err := r.notesIn(ctx, notebookID)
+    if err != nil {
+        log.Printf("ERROR loading notes for %s: %v", path, err)
+        result.fail(err)
+        return result
+    }
+    // Held until the file is done; with --content_addressed the lock covers every title with this name.
+    defer r.titleLocks.lock(notebookID + "\x00" + title)()
+
+    if st, err := os.Stat(path); err == nil {
+        result.modTime = st.ModTime()
+        if rec, ok := r.trustedRecord(path, st); ok && !r.contentAddressed {
+            if note, ok := r.cachedNote(notes, title); ok && note.ID == rec.NoteID {
+                // Same size and mtime as when it was last backed up: assume unchanged without hashing.
+                result.Status = "unchanged"
+                result.NoteID = rec.NoteID
+                result.ResourceID = rec.ResourceID
+                result.SHA256 = rec.SHA256
+                result.Size = rec.Size
+                return result
+            }
+        }
+    }
 
-        var payload NotesResponse
-        if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
-            resp.Body.Close()
-            return nil, fmt.Errorf("decode notes page %d: %w", page, err)
+    release := r.client.OpenFiles.Acquire()
+    sum, size, err := fileSHA256(path)
+    release()
+    if errors.Is(err, fs.ErrNotExist) {
+        result.Status = "vanished"
+        result.err = err
+        return result
+    }
+    if errors.Is(err, fs.ErrPermission) {
+        // Left to the walk's --on_unreadable policy rather than reported as a failed upload.
+        result.Status = "unreadable"
+        result.Error = err.Error()
+        result.err = err
+        return result
+    }
+    if err != nil {
+        log.Printf("ERROR hashing %s: %v", path, err)
+        result.fail(err)
+        return result
+    }
+    result.SHA256 = sum
+    result.Size = size
+
+    companions, companionSum, err := r.findCompanions(path)
+    if err != nil {
+        log.Printf("ERROR reading companion files of %s: %v", path, err)
+        result.fail(err)
+        return result
+    }
+
+    if r.contentAddressed {
+        title = sum + " " + title
+        result.Title = title
+
+        // Content-addressed notes are immutable: identical content is already archived.
+        if note, ok := r.cachedNote(notes, title); ok {
+            result.Status = "unchanged"
+            result.NoteID = note.ID
+            return result
         }
-        resp.Body.Close()
+    }
 
-        for _, n := range payload.Items {
-            result[n.Title] = n
+    var existing *joplin.Note
+    var idsRecorded bool
+    if r.sidecarIDs {
+        existing, idsRecorded, err = r.noteFromIDSidecar(ctx, path)
+        if err != nil {
+            log.Printf("ERROR loading note recorded in %s: %v", path+idSidecarSuffix, err)
+            result.fail(err)
+            return result
+        }
+    }
+    if existing == nil {
+        if note, ok := r.cachedNote(notes, title); ok {
+            note, err = r.withBody(ctx, notes, note)
+            if err != nil {
+                log.Printf("ERROR loading note for %s: %v", path, err)
+                result.fail(err)
+                return result
+            }
+            existing = &note
+        }
+    }
+    if existing != nil {
+        note := *existing
+
+        // Same content as recorded: no upload and no body rewrite, so Joplin has nothing to sync.
+        meta := parseBodyMeta(note.Body)
+        if r.onlyIfChanged && meta["sha256"] == sum && meta["companions_sha256"] == companionSum && !r.needsRepair(ctx, note) {
+            result.Status = "unchanged"
+            result.NoteID = note.ID
+            if r.sidecarIDs && !idsRecorded && !r.preview {
+                if ids := extractResourceIDs(note.Body); len(ids) > 0 {
+                    r.writeIDSidecar(path, note.ID, ids[len(ids)-1])
+                }
+            }
+            return result
         }
 
-        if !payload.HasMore {
-            break
+        if r.skipConflicts {
+            if expected, err := r.expectedBody(path, name, note); err != nil || expected != note.Body {
+                log.Printf("WARNING: skipping %s: note %s was edited in Joplin since the last backup (--on_conflict=skip)", path, note.ID)
+                result.Status = "conflict"
+                result.NoteID = note.ID
+                return result
+            }
         }
-        page++
     }
 
-    return result, nil
-}
+    if r.preview {
+        return r.previewFile(ctx, path, name, createdAt, sum, size, companions, companionSum, existing, result)
+    }
 
-// UploadResource uploads a file as a Joplin resource and returns its metadata.
-func (c *Client) UploadResource(path, title string) (*Resource, error) {
-    f, err := os.Open(path)
-    if err != nil {
-        return nil, fmt.Errorf("open file: %w", err)
+    var oldResources []joplin.Resource
+    if existing != nil {
+        // Taken before the update, while Joplin still lists the old attachments.
+        oldResources = r.noteResources(ctx, *existing)
     }
-    defer f.Close()
 
-    var buf bytes.Buffer
-    writer := multipart.NewWriter(&buf)
+    resourceTitle := name
+    if r.uniqueResourceTitles {
+        resourceTitle = uniqueResourceTitle(name, oldResources)
+    }
 
-    fileField, err := writer.CreateFormFile("data", filepath.Base(path))
+    links, companionIDs, err := r.storeCompanions(ctx, path, companions)
     if err != nil {
-        return nil, fmt.Errorf("create form file: %w", err)
+        log.Printf("ERROR uploading resources for %s: %v", path, err)
+        result.fail(err)
+        return result
+    }
+    rollbackCompanions := func() {
+        for _, id := range companionIDs {
+            r.rollbackResource(ctx, id, path)
+        }
+    }
+
+    // res stays nil when the file is stored outside Joplin.
+    var res *joplin.Resource
+    var body string
+    if r.externalizeAbove > 0 && size > r.externalizeAbove {
+        var location string
+        location, err = r.externalize(path, sum)
+        if err == nil {
+            body, err = r.noteBody(path, title, createdAt, sum, size, "", links+externalLink(name, location), location, companionSum)
+        }
+        if err != nil {
+            log.Printf("ERROR storing %s externally: %v", path, err)
+            rollbackCompanions()
+            result.fail(err)
+            return result
+        }
+    } else {
+        // Loading a new resource
+        res, err = r.storeResource(ctx, path, resourceTitle, size)
+        if err != nil {
+            log.Printf("ERROR uploading resource for %s: %v", path, err)
+            rollbackCompanions()
+            result.fail(err)
+            return result
+        }
+        result.ResourceID = res.ID
+
+        body, err = r.noteBody(path, title, createdAt, sum, size, res.ID, links+resourceLink(name, res.ID), "", companionSum)
+        if err != nil {
+            log.Printf("ERROR building note body for %s: %v", path, err)
+            if r.twoPhase {
+                r.rollbackResource(ctx, res.ID, path)
+                rollbackCompanions()
+            }
+            result.fail(err)
+            return result
+        }
     }
 
-    if _, err := io.Copy(fileField, f); err != nil {
-        return nil, fmt.Errorf("copy file data: %w", err)
+    // The note's dates follow the file rather than the moment it was backed up.
+    noteOpts := joplin.NoteOptions{UserCreatedTime: createdAt.UnixMilli()}
+    if !result.modTime.IsZero() {
+        noteOpts.UserUpdatedTime = result.modTime.UnixMilli()
+    }
+    if r.orderByCreated {
+        noteOpts.Order = createdAt.UnixMilli()
     }
 
-    props := map[string]string{"title": title}
-    propsJSON, err := json.Marshal(props)
+    if existing != nil {
+        result.NoteID = existing.ID
+    }
+    note, status, err := r.client.UpsertNote(ctx, existing, notebookID, title, body, noteOpts)
     if err != nil {
-        return nil, fmt.Errorf("marshal props: %w", err)
+        log.Printf("ERROR saving note for %s: %v", path, err)
+        if r.twoPhase && res != nil {
+            r.rollbackResource(ctx, res.ID, path)
+            rollbackCompanions()
+        }
+        result.fail(err)
+        return result
+    }
+    oldTitle := ""
+    if existing != nil && existing.Title != title {
+        // The file was renamed since the note was bound to it via its ID sidecar.
+        oldTitle = existing.Title
+    }
+    r.cacheNote(notes, title, oldTitle, *note)
+    result.Status = status
+    result.NoteID = note.ID
+    r.tagNote(ctx, path, note.ID)
+    if r.sidecarIDs {
+        r.writeIDSidecar(path, note.ID, result.ResourceID)
     }
 
-    if err := writer.WriteField("props", string(propsJSON)); err != nil {
-        return nil, fmt.Errorf("write props field: %w", err)
+    if existing != nil {
+        // After successful update - delete old resources
+        stale := staleResources(resourceIDs(oldResources), body)
+        for i, err := range r.deleteResources(ctx, stale) {
+            if err != nil {
+                log.Printf("WARNING: failed to delete old resource %s for %s: %v", stale[i], path, err)
+            } else {
+                result.resourcesDeleted++
+                fmt.Fprintf(r.out, "  cleaned old resource %s for %s\n", stale[i], path)
+            }
+        }
     }
 
-    if err := writer.Close(); err != nil {
-        return nil, fmt.Errorf("close multipart writer: %w", err)
+    return result
+}
+
+// needsRepair reports whether the resource linked from a note has a different size in Joplin than the
+// size_bytes recorded in the body, which indicates a truncated upload by an earlier run.
+// It only checks when --repair is set and the body records a size.
+func (r *runner) needsRepair(ctx context.Context, note joplin.Note) bool {
+    if !r.repair {
+        return false
     }
 
-    u := c.buildURL("/resources", nil)
-    req, err := http.NewRequest(http.MethodPost, u, &buf)
-    if err != nil {
-        return nil, fmt.Errorf("new request: %w", err)
+    recorded, err := strconv.ParseInt(parseBodyMeta(note.Body)["size_bytes"], 10, 64)
+    ids := extractResourceIDs(note.Body)
+    if err != nil || len(ids) == 0 {
+        return false
     }
-    req.Header.Set("Content-Type", writer.FormDataContentType())
 
-    resp, err := c.HTTP.Do(req)
+    // The managed resource link is always the last one in the body.
+    resourceID := ids[len(ids)-1]
+    stored, err := r.client.Resource(ctx, resourceID, "id", "size")
     if err != nil {
-        return nil, fmt.Errorf("do request: %w", err)
+        log.Printf("WARNING: cannot check resource %s of %q for repair: %v", resourceID, note.Title, err)
+        return false
+    }
+    if stored.Size == recorded {
+        return false
     }
-    defer resp.Body.Close()
 
-    if resp.StatusCode >= 300 {
-        body, _ := io.ReadAll(resp.Body)
-        return nil, fmt.Errorf("upload resource failed: status=%d body=%s", resp.StatusCode, string(body))
+    log.Printf("repairing %q: resource %s has %d bytes, note records %d", note.Title, resourceID, stored.Size, recorded)
+    return true
+}
+
+// noteBody returns the note body for a file: the sidecar content when a sidecar exists,
+// otherwise the generated metadata template. Both end with link (the managed resource link, or the
+// external link with externalLocation recorded in the metadata). Only generated text is normalized with
+// normalizeBody; sidecar and template content is kept as written (see joinBody).
+func (r *runner) noteBody(path, title string, createdAt time.Time, sum string, size int64, resourceID, link, externalLocation, companionSum string) (string, error) {
+    body, ok, err := r.sidecarBody(path, link)
+    if err != nil {
+        return "", err
     }
+    if !ok && r.bodyTemplate != nil {
+        displayPath, _ := sanitizeUTF8(path)
+        data := bodyTemplateData{
+            Title:            title,
+            Path:             displayPath,
+            CreatedAt:        createdAt,
+            UploadAt:         time.Now(),
+            ResourceID:       resourceID,
+            Size:             size,
+            SHA256:           sum,
+            ExternalLocation: externalLocation,
+            CompanionsSHA256: companionSum,
+        }
+        if r.git != nil {
+            data.GitCommit, data.GitStatus = r.git.head, r.git.status(path)
+        }
+        var b strings.Builder
+        if err := r.bodyTemplate.Execute(&b, data); err != nil {
+            return "", fmt.Errorf("render body template: %w", err)
+        }
+        // As with sidecars, the managed link always ends the body.
+        body, ok = joinBody(b.String(), link), true
+    }
+    if !ok {
+        displayPath, _ := sanitizeUTF8(path)
+        createdAtStr := createdAt.Format("2006-01-02 15:04:05.000 -0700")
+        uploadAt := time.Now()
+        uploadAtStr := uploadAt.Format("2006-01-02 15:04:05.000 -0700")
 
-    var res Resource
-    if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-        return nil, fmt.Errorf("decode resource: %w", err)
+        body = metaBody(createdAtStr, uploadAtStr, displayPath, sum, strconv.FormatInt(size, 10))
+        if externalLocation != "" {
+            body += fmt.Sprintf("external_location: %q\n", externalLocation)
+        }
+        if r.git != nil {
+            body += fmt.Sprintf("git_commit: %q\ngit_status: %q\n", r.git.head, r.git.status(path))
+        }
+        if companionSum != "" {
+            body += fmt.Sprintf("companions_sha256: %q\n", companionSum)
+        }
+        body = normalizeBody(body + "\n" + link)
     }
 
-    return &res, nil
+    return body, nil
 }
 
-// DeleteResource deletes a resource from Joplin by ID.
-// Does not touch notes, notebooks, tags - only the resource file itself.
-func (c *Client) DeleteResource(id string) error {
-    u := c.buildURL("/resources/"+id, nil)
+// resourceLink returns the markdown link to the backed up resource that ends every managed note body.
+func resourceLink(title, resourceID string) string {
+    return fmt.Sprintf("[%s](:/%s)\n", title, resourceID)
+}
 
-    req, err := http.NewRequest(http.MethodDelete, u, nil)
-    if err != nil {
-        return fmt.Errorf("new DELETE request: %w", err)
+// sidecarBody returns the sidecar content followed by link, or ok=false when there is no sidecar for path.
+func (r *runner) sidecarBody(path, link string) (body string, ok bool, err error) {
+    if r.sidecarSuffix == "" {
+        return "", false, nil
     }
 
-    resp, err := c.HTTP.Do(req)
+    data, err := os.ReadFile(path + r.sidecarSuffix)
+    if os.IsNotExist(err) {
+        return "", false, nil
+    }
     if err != nil {
-        return fmt.Errorf("do DELETE: %w", err)
+        return "", false, fmt.Errorf("read sidecar: %w", err)
     }
-    defer resp.Body.Close()
+    return joinBody(string(data), link), true, nil
+}
 
-    // If the resource has already been deleted, it is not critical.
-    if resp.StatusCode == http.StatusNotFound {
-        return nil
+// metaBody formats the metadata block of a note body (without the blank line and the resource link).
+func metaBody(createdAt, uploadAt, filePath, sum, size string) string {
+    return fmt.Sprintf(
+        "created_at: %q\n"+
+            "upload_at: %q\n"+
+            "file_path: %q\n"+
+            "sha256: %q\n"+
+            "size_bytes: %q\n",
+        createdAt,
+        uploadAt,
+        filePath,
+        sum,
+        size,
+    )
+}
+
+// report prints the per-file status line and, if enabled, the NDJSON record.
+func (r *runner) report(result fileResult) {
+    r.stats.Processed++
+    r.stats.ResourcesDeleted += result.resourcesDeleted
+    switch result.Status {
+    case "added":
+        r.stats.Added++
+    case "updated":
+        r.stats.Updated++
+    case "unchanged":
+        r.stats.Unchanged++
+    case "error":
+        r.stats.Errors++
+    case "conflict":
+        r.stats.Conflicts++
     }
 
-    if resp.StatusCode >= 300 {
-        bodyBytes, _ := io.ReadAll(resp.Body)
-        return fmt.Errorf("delete resource failed: status=%d body=%s", resp.StatusCode, string(bodyBytes))
+    if !r.jsonLog {
+        if err := r.outputTemplate.Execute(r.out, result); err != nil {
+            log.Printf("WARNING: failed to render output line for %s: %v", result.Path, err)
+        }
+        fmt.Fprintln(r.out)
     }
 
-    return nil
+    if r.stream != nil {
+        // os.Stdout is unbuffered, so every record reaches the pipe as soon as it is encoded.
+        if err := r.stream.Encode(result); err != nil {
+            log.Printf("WARNING: failed to write json stream record for %s: %v", result.Path, err)
+        }
+    }
 }
 
-// CreateNote creates a new note in the given notebook.
-func (c *Client) CreateNote(notebookId, title, body string) (*Note, error) {
-    payload := map[string]string{
-        "title":     title,
-        "parent_id": notebookId,
-        "body":      body,
-    }
-    data, err := json.Marshal(payload)
-    if err != nil {
-        return nil, fmt.Errorf("marshal note: %w", err)
+func main() {
+    started := time.Now()
+    log.SetFlags(0)
+
+    var notebookId string
+    var directory string
+    var fileExtension string
+    var jsonStream bool
+    var serverMode bool
+    var serverURL string
+    var serverEmail string
+    var fsyncState bool
+    var sidecarSuffix string
+    var autoTagByExtension bool
+    var shutdownGrace time.Duration
+    var audit bool
+    var retries int
+    var retryBudgetSize int
+    var indexTitle string
+    var contentAddressed bool
+    var restrictToRoot bool
+    var onlyIfChanged bool
+    var mirrorTree bool
+    var dedupe bool
+    var dryRun bool
+    var yes bool
+    var perFileTimeout time.Duration
+    var outputTemplate string
+    var orderByCreated bool
+    var repair bool
+    var cleanupConcurrency int
+    var collisionReport bool
+    var reportDrift bool
+    var sidecarIDs bool
+    var maxNotebookDepth int
+    var maxNotebookDepthAction string
+    var onClockSkew string
+    var resourceTitleDedupSuffix bool
+    var preflightReadFiles int
+    var titleMapPath string
+    var twoPhase bool
+    var twoPhaseTimeout time.Duration
+    var retryVanished bool
+    var verifySize bool
+    var resourceRefs bool
+    var strictDecode bool
+    var emptyDirMarkers bool
+    var stateFile string
+    var externalizeAbove string
+    var apiBase string
+    var dryRunDiff bool
+    var httpTimeout time.Duration
+    var verbose bool
+    var safeMode bool
+    var onConflict string
+    var requireNotebook bool
+    var listNotes bool
+    var concurrency int
+    var prune bool
+    var trustMtime bool
+    var maxOpenFiles int
+    var recursive bool
+    var includeGit bool
+    var includePatterns string
+    var verify bool
+    var scanOnlyMode bool
+    var logFormat string
+    var timeoutBackoff float64
+    var printSchema bool
+    var tag string
+    var notebookName string
+    var failFast bool
+    var lazyBodies bool
+    var resourceMime string
+    var tokenFile string
+    var bodyTemplate string
+    var companionExtensions string
+    var since string
+    var ignoreFile string
+    var cleanupOrphans bool
+    var rate float64
+    var bodyTemplateFile string
+    var authMode string
+    var createNotebook bool
+    var parentNotebookId string
+    var checkNoteCount bool
+    var noteCountTolerance int
+    var strict bool
+    var excludePatterns string
+    var externalStore string
+    var externalURLBase string
+    var maxClockSkew time.Duration
+    var onUnreadable string
+
+    flag.StringVar(&notebookId, "notebook_id", "", "Joplin notebook (folder) ID")
+    flag.StringVar(&notebookName, "notebook_name", "", "Joplin notebook (folder) title, resolved to its ID at startup; alternative to --notebook_id")
+    flag.BoolVar(&createNotebook, "create_notebook", false, "Create the --notebook_name notebook if it does not exist")
+    flag.StringVar(&parentNotebookId, "parent_notebook_id", "", "Look up (and create) the --notebook_name notebook inside this notebook only")
+    flag.StringVar(&directory, "directory", "", "Directory to scan for files")
+    flag.StringVar(&fileExtension, "file_extension", ".smmx", "Comma-separated file extensions to back up (e.g. .smmx,.pdf); empty = all files")
+    flag.BoolVar(&jsonStream, "json_stream", false, "Write one JSON object per processed file to stdout (NDJSON); human-readable output goes to stderr")
+
+    flag.BoolVar(&serverMode, "server_mode", false, "Back up directly to Joplin Server instead of the desktop Web Clipper API")
+    flag.StringVar(&serverURL, "server_url", joplin.JOPLIN_SERVER_BASE, "Joplin Server base URL (server mode only)")
+    flag.StringVar(&serverEmail, "server_email", "", "Joplin Server account email (server mode only)")
+
+    flag.BoolVar(&fsyncState, "fsync_state", false, "fsync local state files (and their directory) after every write")
+
+    flag.StringVar(&sidecarSuffix, "sidecar_suffix", "", "Use <file><suffix> (e.g. .notes.md) as the note body when it exists")
+
+    flag.BoolVar(&autoTagByExtension, "auto_tag_by_extension", false, "Tag every note with its file extension (e.g. pdf)")
+
+    flag.DurationVar(&shutdownGrace, "shutdown_grace", 30*time.Second, "On SIGINT/SIGTERM, how long to wait for the in-flight file before cancelling it")
+
+    flag.BoolVar(&audit, "audit", false, "Read-only: re-download every note's resource and compare it with the recorded sha256")
+
+    flag.IntVar(&retries, "retries", 0, "Retry transient HTTP failures (connection errors, 429, 5xx) up to N times per request")
+    flag.IntVar(&retryBudgetSize, "retry_budget", 0, "Total retries allowed across the whole run before aborting (0 = unlimited)")
+
+    flag.StringVar(&indexTitle, "index_note", "", "Title of an index note, kept up to date with links to every note in the notebook")
+
+    flag.BoolVar(&contentAddressed, "content_addressed", false, "Immutable archive: title notes by content hash and never update existing notes")
+
+    flag.BoolVar(&restrictToRoot, "restrict_to_root", true, "Skip symlinked files whose target resolves outside --directory")
+
+    flag.BoolVar(&onlyIfChanged, "only_if_changed", true, "Leave notes untouched (no upload, no body rewrite) when the file's sha256 matches the recorded one")
+
+    flag.BoolVar(&mirrorTree, "mirror_tree", false, "Mirror subdirectories as nested sub-notebooks of --notebook_id")
+
+    flag.BoolVar(&dedupe, "dedupe", false, "Maintenance: delete notes whose recorded sha256 duplicates a newer note (requires --yes or --dry_run)")
+    flag.BoolVar(&dryRun, "dry_run", false, "Report what the backup (or --dedupe) would do without changing anything in Joplin or on disk")
+    flag.BoolVar(&yes, "yes", false, "Confirm destructive maintenance operations")
+
+    flag.DurationVar(&perFileTimeout, "per_file_timeout", 0, "Maximum time for one file's upload, note update and cleanup (e.g. 10m; 0 = no limit)")
+
+    flag.StringVar(&outputTemplate, "output_template", defaultOutputTemplate, "Go text/template for the per-file output line (fields: .Path .Title .Status .NoteID .ResourceID .SHA256 .Size .CreatedAtUTC .Error)")
+
+    flag.BoolVar(&orderByCreated, "order_by_created", false, "Set each note's manual sort order from the file's creation time")
+
+    flag.BoolVar(&repair, "repair", false, "With --only_if_changed: re-upload files whose stored resource size differs from the recorded size_bytes")
+
+    flag.IntVar(&cleanupConcurrency, "cleanup_concurrency", 1, "Maximum number of old resources deleted in parallel")
+
+    flag.BoolVar(&collisionReport, "collision_report", false, "Read-only: list duplicate note titles in the notebook and file names found in several directories")
+
+    flag.StringVar(&onUnreadable, "on_unreadable", "warn", "Files or directories that cannot be read: skip (log only), warn (log and count in the summary) or fail (abort the run)")
+
+    flag.BoolVar(&reportDrift, "report_drift", false, "Read-only: list notes whose body was edited outside this tool and would be overwritten by a backup run")
+
+    flag.BoolVar(&sidecarIDs, "sidecar_ids", false, "Record the note and resource ID in <file>.joplin and match the note by that ID on later runs")
+
+    flag.IntVar(&maxNotebookDepth, "max_notebook_depth", 0, "With --mirror_tree: maximum sub-notebook nesting (0 = unlimited)")
+    flag.StringVar(&maxNotebookDepthAction, "max_notebook_depth_action", "flatten", "Deeper directories: flatten (prefix the note title with the remaining path) or abort")
+
+    flag.StringVar(&onClockSkew, "on_clock_skew", "ignore", "Compare the local clock with the Joplin host's Date header: ignore (no check), warn or abort")
+    flag.DurationVar(&maxClockSkew, "max_clock_skew", 5*time.Minute, "Largest tolerated clock difference for --on_clock_skew")
+
+    flag.BoolVar(&resourceTitleDedupSuffix, "resource_title_dedup_suffix", false, "Give a new resource a numbered title (\"report (2).pdf\") when the note already has a resource with the same title")
+
+    flag.IntVar(&preflightReadFiles, "preflight_read_test", 0, "Before the backup, fully read N randomly chosen matching files and abort on I/O errors (0 = off)")
+
+    flag.StringVar(&titleMapPath, "title_map", "", "JSON object or .csv file mapping a file (relative path or base name) to its note title")
+
+    flag.BoolVar(&twoPhase, "two_phase", false, "Only write the note once Joplin reports the full resource size; delete the resource if the note cannot be written")
+    flag.DurationVar(&twoPhaseTimeout, "two_phase_timeout", 10*time.Second, "With --two_phase: how long to wait for the stored resource size to match")
+
+    flag.BoolVar(&retryVanished, "retry_vanished", false, "After the scan, re-scan once every file or directory that vanished during it and exists again")
+
+    flag.BoolVar(&verifySize, "verify_size", false, "Compare each uploaded resource's stored size with the file; delete and re-upload on mismatch")
+
+    flag.BoolVar(&resourceRefs, "resource_refs_report", false, "Read-only: list resources referenced by several notes of the notebook or by no note at all")
+
+    flag.BoolVar(&strictDecode, "strict_decode", false, "Warn when Joplin API responses contain fields the client does not model (API drift check)")
+
+    flag.BoolVar(&emptyDirMarkers, "empty_dir_markers", false, "Record every empty directory as a marker note (no resource) titled by its relative path")
+
+    flag.StringVar(&stateFile, "state_file", "", "Local JSON state file; records run start/completion so an interrupted run is resumed automatically")
+
+    flag.StringVar(&externalizeAbove, "externalize_above", "", "Store files larger than this size (e.g. 500MB) in --external_store instead of uploading them to Joplin")
+    flag.StringVar(&externalStore, "external_store", "", "Directory that receives externalized files, named by content hash")
+    flag.StringVar(&externalURLBase, "external_url_base", "", "URL under which --external_store is served; notes link to file:// URLs when empty")
+
+    flag.StringVar(&apiBase, "api_base", "", "Joplin Web Clipper API base URL (default: $JOPLIN_API_BASE, then "+joplin.JOPLIN_API_BASE+")")
+
+    flag.BoolVar(&dryRunDiff, "dry_run_diff", false, "Preview the backup without uploading or writing: print each new note body and a diff for each note that would be updated")
+
+    flag.DurationVar(&httpTimeout, "timeout", 15*time.Second, "Timeout for each HTTP request, including uploads (e.g. 2m; 0 = no timeout)")
+
+    flag.BoolVar(&verbose, "verbose", false, "Log extra diagnostics, such as the connection latency at startup")
+
+    flag.BoolVar(&safeMode, "safe_mode", false, "Conservative preset: --on_conflict=skip --require_notebook --verify_size, except where given explicitly (with --body_template, pass --on_conflict=overwrite)")
+    flag.StringVar(&onConflict, "on_conflict", "overwrite", "What to do with notes edited in Joplin since the last backup: overwrite or skip")
+    flag.BoolVar(&requireNotebook, "require_notebook", false, "Abort unless --notebook_id names an existing notebook")
+
+    flag.BoolVar(&listNotes, "list_notes", false, "List the notebook's notes with their resources and recorded file path and hash, then exit (a table, or NDJSON with --json_stream)")
+
+    flag.IntVar(&concurrency, "concurrency", 1, "Number of files backed up in parallel")
+
+    flag.BoolVar(&prune, "prune", false, "After the scan, delete notes (and their unused resources) whose file no longer exists")
+
+    flag.BoolVar(&trustMtime, "trust_mtime", true, "With --state_file, treat files with the recorded size and mtime as unchanged without hashing them")
+
+    flag.IntVar(&maxOpenFiles, "max_open_files", defaultMaxOpenFiles(), "Maximum number of source files open at once, by default a quarter of the open-file limit (0 = unlimited)")
+
+    flag.BoolVar(&recursive, "recursive", true, "Descend into subdirectories of --directory")
+
+    flag.BoolVar(&includeGit, "include_git", false, "Record the HEAD commit and each file's git status in the note body when --directory is in a git work tree")
+
+    flag.StringVar(&includePatterns, "include", "", "Comma-separated glob patterns; only files whose name matches one are backed up (e.g. 'report-*')")
+    flag.StringVar(&excludePatterns, "exclude", "", "Comma-separated glob patterns; files whose name matches one are skipped (e.g. '~$*,*.tmp.*')")
+
+    flag.BoolVar(&verify, "verify", false, "Check each uploaded resource's stored size in Joplin; on a mismatch delete it and fail the file")
+
+    flag.BoolVar(&scanOnlyMode, "scan_only", false, "Only scan --directory and print statistics about the files a backup would process, without contacting Joplin")
+
+    flag.Float64Var(&timeoutBackoff, "timeout_backoff_factor", 1, "Multiply --timeout by this factor for each retry after a timed out attempt (1 = same timeout)")
+    flag.StringVar(&logFormat, "log_format", "text", "Output format: text, or json for one JSON object per file and per message")
+
+    flag.StringVar(&tag, "tag", "", "Tag every created or updated note with this tag (e.g. auto-backup)")
+    flag.BoolVar(&checkNoteCount, "check_note_count", false, "After the run, check that the notebook's note count changed exactly by the notes created minus the notes pruned")
+    flag.IntVar(&noteCountTolerance, "note_count_tolerance", 0, "Difference from the expected note count tolerated by --check_note_count")
+    flag.BoolVar(&strict, "strict", false, "Exit with status 1 when --check_note_count finds a mismatch (default: warn only)")
+    flag.StringVar(&authMode, "auth_mode", "query", "How the Web Clipper token is sent: query (?token=, Joplin's default) or header (Authorization: Bearer)")
+    flag.Float64Var(&rate, "rate", 0, "Maximum number of requests per second sent to Joplin (0 = unlimited)")
+    flag.BoolVar(&cleanupOrphans, "cleanup_orphans", false, "Maintenance: delete resources no note references (requires --yes or --dry_run)")
+    flag.StringVar(&ignoreFile, "ignore_file", "", "gitignore-style file of paths to skip, relative to --directory (default: --directory/.joplinignore if present)")
+    flag.StringVar(&since, "since", "", "Only back up files modified after this time: RFC 3339 (2024-05-01T00:00:00Z) or a duration before now (24h)")
+    flag.StringVar(&companionExtensions, "companion_extensions", "", "Comma-separated extensions of files attached to the note of the file with the same base name, e.g. .png for map.smmx + map.png")
+    flag.StringVar(&bodyTemplate, "body_template", "", "Go text/template for note bodies (fields: .Title .Path .CreatedAt .UploadAt .ResourceID .Size .SHA256 .ExternalLocation .GitCommit .GitStatus); the resource link is appended")
+    flag.StringVar(&bodyTemplateFile, "body_template_file", "", "Read --body_template from this file")
+    flag.StringVar(&tokenFile, "token_file", "", "Read the Web Clipper token from this file instead of JOPLIN_TOKEN (e.g. a mounted secret)")
+    flag.StringVar(&resourceMime, "resource_mime", "", "MIME type of every uploaded resource, e.g. application/zip (default: detected from the extension, then the content)")
+    flag.BoolVar(&lazyBodies, "lazy_bodies", false, "List the notebook without note bodies and fetch a body only when a file matches the note (large notebooks)")
+    flag.BoolVar(&failFast, "fail_fast", false, "Stop the run at the first file that fails (default: back up the remaining files, then exit with status 1)")
+    flag.BoolVar(&printSchema, "print_config_schema", false, "Print a JSON Schema of all options (types, defaults, descriptions) and exit")
+
+    flag.Parse()
+
+    if printSchema {
+        if err := printConfigSchema(os.Stdout); err != nil {
+            log.Fatalf("ERROR: %v", err)
+        }
+        return
     }
 
-    u := c.buildURL("/notes", nil)
-    resp, err := c.HTTP.Post(u, "application/json", bytes.NewReader(data))
-    if err != nil {
-        return nil, fmt.Errorf("post note: %w", err)
+    switch logFormat {
+    case "text":
+    case "json":
+        log.SetOutput(newJSONLineWriter(os.Stderr))
+    default:
+        log.Fatalf("ERROR: --log_format must be text or json, got %q.", logFormat)
     }
-    defer resp.Body.Close()
 
-    if resp.StatusCode >= 300 {
-        bodyBytes, _ := io.ReadAll(resp.Body)
-        return nil, fmt.Errorf("create note failed: status=%d body=%s", resp.StatusCode, string(bodyBytes))
+    var safeApplied []string
+    if safeMode {
+        var err error
+        safeApplied, err = applySafeMode()
+        if err != nil {
+            log.Fatalf("ERROR: --safe_mode: %v", err)
+        }
+        if len(safeApplied) > 0 {
+            log.Printf("Safe mode: %s", strings.Join(safeApplied, " "))
+        }
     }
 
-    var note Note
-    if err := json.NewDecoder(resp.Body).Decode(&note); err != nil {
-        return nil, fmt.Errorf("decode note: %w", err)
+    var token, serverPassword string
+    switch {
+    case scanOnlyMode:
+        // Joplin is never contacted.
+    case serverMode:
+        serverPassword = os.Getenv("JOPLIN_SERVER_PASSWORD")
+        if serverEmail == "" || serverPassword == "" {
+            log.Fatal("ERROR: server mode requires --server_email and the JOPLIN_SERVER_PASSWORD environment variable.")
+        }
+    case tokenFile != "":
+        var err error
+        token, err = readTokenFile(tokenFile)
+        if err != nil {
+            log.Fatalf("ERROR: --token_file: %v", err)
+        }
+    default:
+        token = os.Getenv("JOPLIN_TOKEN")
+        if token == "" {
+            log.Fatal("ERROR: Environment variable JOPLIN_TOKEN is not set or empty (or pass --token_file).")
+        }
     }
 
-    return &note, nil
-}
+    if resourceMime != "" {
+        if _, _, err := mime.ParseMediaType(resourceMime); err != nil {
+            log.Fatalf("ERROR: invalid --resource_mime %q: %v", resourceMime, err)
+        }
+    }
+    if authMode != "query" && authMode != "header" {
+        log.Fatalf("ERROR: invalid --auth_mode %q: expected query or header", authMode)
+    }
 
-// UpdateNote updates an existing note (title, parent_id, body).
-func (c *Client) UpdateNote(id, notebookId, title, body string) error {
-    payload := map[string]string{
-        "title":     title,
-        "parent_id": notebookId,
-        "body":      body,
+    if apiBase == "" {
+        apiBase = os.Getenv("JOPLIN_API_BASE")
+    }
+    if apiBase == "" {
+        apiBase = joplin.JOPLIN_API_BASE
+    }
+    if u, err := url.Parse(apiBase); err != nil || u.Scheme == "" || u.Host == "" {
+        log.Fatalf("ERROR: invalid Joplin API base URL %q: expected something like http://host:41184", apiBase)
     }
-    data, err := json.Marshal(payload)
+
+    outputTmpl, err := parseOutputTemplate(outputTemplate)
     if err != nil {
-        return fmt.Errorf("marshal note update: %w", err)
+        log.Fatalf("ERROR: invalid --output_template: %v", err)
+    }
+
+    var bodyTmpl *template.Template
+    if text, err := loadBodyTemplate(bodyTemplate, bodyTemplateFile); err != nil {
+        log.Fatalf("ERROR: %v", err)
+    } else if text != "" {
+        if reportDrift {
+            log.Fatal("ERROR: --body_template cannot be combined with --report_drift, which rebuilds the default body.")
+        }
+        if onConflict == "skip" && slices.Contains(safeApplied, "on_conflict=skip") {
+            log.Fatal("ERROR: --safe_mode sets --on_conflict=skip, which rebuilds the default body and cannot be combined with --body_template. Pass --on_conflict=overwrite to keep the rest of the preset.")
+        }
+        if onConflict == "skip" {
+            log.Fatal("ERROR: --body_template cannot be combined with --on_conflict=skip, which rebuilds the default body.")
+        }
+        bodyTmpl, err = parseBodyTemplate(text)
+        if err != nil {
+            log.Fatalf("ERROR: invalid --body_template: %v", err)
+        }
+        missing := missingBodyMeta(bodyTmpl)
+        if slices.Contains(missing, "sha256") && (onlyIfChanged || audit || dedupe) {
+            log.Fatal(`ERROR: --body_template must keep a 'sha256: "{{.SHA256}}"' line, which --only_if_changed, --audit and --dedupe read; pass --only_if_changed=false to rewrite every note on each run instead.`)
+        }
+        if len(missing) > 0 {
+            log.Printf(`WARNING: --body_template output has no recoverable %s line (e.g. 'file_path: {{printf "%%q" .Path}}'); --prune never deletes notes written with it and --list_notes shows the field empty.`, strings.Join(missing, "/"))
+        }
     }
 
-    u := c.buildURL("/notes/"+id, nil)
-    req, err := http.NewRequest(http.MethodPut, u, bytes.NewReader(data))
+    sinceCutoff, err := parseSince(since, time.Now())
     if err != nil {
-        return fmt.Errorf("new PUT request: %w", err)
+        log.Fatalf("ERROR: invalid --since: %v", err)
     }
-    req.Header.Set("Content-Type", "application/json")
 
-    resp, err := c.HTTP.Do(req)
+    exts := parseExtensions(fileExtension)
+    companionExts := parseExtensions(companionExtensions)
+    for ext := range companionExts {
+        if exts[ext] {
+            log.Fatalf("ERROR: %s is in both --file_extension and --companion_extensions.", ext)
+        }
+    }
+    names, err := parseNameFilter(includePatterns, excludePatterns)
     if err != nil {
-        return fmt.Errorf("do PUT: %w", err)
+        log.Fatalf("ERROR: %v", err)
     }
-    defer resp.Body.Close()
 
-    if resp.StatusCode >= 300 {
-        bodyBytes, _ := io.ReadAll(resp.Body)
-        return fmt.Errorf("update note failed: status=%d body=%s", resp.StatusCode, string(bodyBytes))
+    if maxOpenFiles < 0 {
+        log.Fatal("ERROR: --max_open_files must not be negative.")
+    }
+    if concurrency < 1 {
+        log.Fatal("ERROR: --concurrency must be at least 1.")
+    }
+    if cleanupConcurrency < 1 {
+        log.Fatal("ERROR: --cleanup_concurrency must be at least 1.")
     }
 
-    return nil
-}
+    switch onUnreadable {
+    case "skip", "warn", "fail":
+    default:
+        log.Fatalf("ERROR: --on_unreadable must be skip, warn or fail, got %q.", onUnreadable)
+    }
 
-// extractResourceIDs searches for all resource IDs from markdown links of the form [name](:/RESOURCE_ID)
-func extractResourceIDs(body string) []string {
-    var ids []string
-    start := 0
+    if dedupe && !yes && !dryRun {
+        log.Fatal("ERROR: --dedupe deletes notes; pass --yes to confirm or --dry_run to preview.")
+    }
+    if cleanupOrphans && !yes && !dryRun {
+        log.Fatal("ERROR: --cleanup_orphans deletes resources; pass --yes to confirm or --dry_run to preview.")
+    }
 
-    for {
-        i := strings.Index(body[start:], "](:/")
-        if i == -1 {
-            break
+    var ignore *ignoreRules
+    if !audit && !dedupe && !listNotes {
+        rawDirectory := directory
+        directory, err = expandPath(directory)
+        if err != nil {
+            log.Fatalf("invalid --directory: %v", err)
+        }
+        dirInfo, err := os.Stat(directory)
+        if err != nil {
+            if directory != rawDirectory {
+                log.Fatalf("cannot stat directory %q (expanded from %q): %v", directory, rawDirectory, err)
+            }
+            log.Fatalf("cannot stat directory %q: %v", directory, err)
+        }
+        if !dirInfo.IsDir() {
+            log.Fatalf("%q is not a directory", directory)
         }
-        i += start
 
-        // resource starts after "](:/"
-        idStart := i + len("](:/")
-        j := strings.Index(body[idStart:], ")")
-        if j == -1 {
-            break
+        if ignoreFile != "" {
+            if ignoreFile, err = expandPath(ignoreFile); err != nil {
+                log.Fatalf("invalid --ignore_file: %v", err)
+            }
+        }
+        ignore, err = loadIgnoreFile(directory, ignoreFile)
+        if err != nil {
+            log.Fatalf("ERROR: ignore file: %v", err)
         }
+    }
 
-        id := body[idStart : idStart+j]
-        if id != "" {
-            ids = append(ids, id)
+    // descend reports whether the walks of directory (backup, --scan_only, reports, preflight) enter the
+    // directory at path.
+    descend := func(path string) bool {
+        if path == directory {
+            return true
         }
+        return recursive && !ignore.ignored(path, true)
+    }
 
-        start = idStart + j
+    // wanted applies the file filters shared by the backup walk, --scan_only, the reports and the preflight test.
+    wanted := func(path string, info os.FileInfo) bool {
+        if !exts.match(info.Name()) || !names.match(info.Name()) {
+            return false
+        }
+        if ignore.ignored(path, false) {
+            return false
+        }
+        // Companions are backed up with their primary file, never as notes of their own.
+        if companionExts[strings.ToLower(filepath.Ext(info.Name()))] {
+            return false
+        }
+        if sidecarIDs && strings.HasSuffix(info.Name(), idSidecarSuffix) {
+            return false
+        }
+        // Sidecars are note content, not files to back up.
+        return sidecarSuffix == "" || !strings.HasSuffix(info.Name(), sidecarSuffix)
     }
 
-    return ids
-}
+    if scanOnlyMode {
+        stats, err := scanOnly(directory, descend, wanted)
+        if err != nil {
+            log.Fatalf("ERROR: %v", err)
+        }
+        var out io.Writer = os.Stdout
+        if logFormat == "json" {
+            out = newJSONLineWriter(os.Stdout)
+        }
+        stats.print(out)
+        return
+    }
 
-// fileCreatedAt returns the "earliest" timestamp available for the file:
-// min(modTime, atime, ctime) on Unix; on other OS falls back to ModTime().
-func fileCreatedAt(info os.FileInfo) time.Time {
-    t := info.ModTime()
+    if serverMode && autoTagByExtension {
+        log.Fatal("ERROR: --auto_tag_by_extension is not supported in server mode.")
+    }
+    if serverMode && tag != "" {
+        log.Fatal("ERROR: --tag is not supported in server mode.")
+    }
+    if notebookName != "" && notebookId != "" {
+        log.Fatal("ERROR: pass either --notebook_id or --notebook_name, not both.")
+    }
+    if serverMode && notebookName != "" {
+        log.Fatal("ERROR: --notebook_name is not supported in server mode; pass --notebook_id.")
+    }
+    if (createNotebook || parentNotebookId != "") && notebookName == "" {
+        log.Fatal("ERROR: --create_notebook and --parent_notebook_id require --notebook_name.")
+    }
+    if stateFile != "" {
+        stateFile, err = expandPath(stateFile)
+        if err != nil {
+            log.Fatalf("invalid --state_file: %v", err)
+        }
+    }
 
-    if stat, ok := info.Sys().(*syscall.Stat_t); ok {
-        // Unix-like systems: use atime, mtime, ctime and take the earliest.
-        atime := time.Unix(int64(stat.Atim.Sec), int64(stat.Atim.Nsec))
-        mtime := time.Unix(int64(stat.Mtim.Sec), int64(stat.Mtim.Nsec))
-        ctime := time.Unix(int64(stat.Ctim.Sec), int64(stat.Ctim.Nsec))
+    var externalizeLimit int64
+    if externalizeAbove != "" {
+        externalizeLimit, err = parseSize(externalizeAbove)
+        if err != nil {
+            log.Fatalf("ERROR: --externalize_above: %v", err)
+        }
+        if externalStore == "" {
+            log.Fatal("ERROR: --externalize_above requires --external_store.")
+        }
+        externalStore, err = expandPath(externalStore)
+        if err != nil {
+            log.Fatalf("invalid --external_store: %v", err)
+        }
+        if info, err := os.Stat(externalStore); err != nil || !info.IsDir() {
+            log.Fatalf("ERROR: --external_store %q is not an existing directory.", externalStore)
+        }
+    }
 
-        t = mtime
-        if atime.Before(t) {
-            t = atime
+    var titleMap map[string]string
+    if titleMapPath != "" {
+        titleMapPath, err = expandPath(titleMapPath)
+        if err != nil {
+            log.Fatalf("invalid --title_map: %v", err)
         }
-        if ctime.Before(t) {
-            t = ctime
+        titleMap, err = loadTitleMap(titleMapPath)
+        if err != nil {
+            log.Fatalf("ERROR: invalid --title_map %q: %v", titleMapPath, err)
+        }
+        for _, title := range titleMap {
+            if indexTitle != "" && title == indexTitle {
+                log.Fatalf("ERROR: --title_map maps a file to the index note title %q.", indexTitle)
+            }
         }
     }
 
-    return t
-}
+    if httpTimeout < 0 {
+        log.Fatal("ERROR: --timeout must not be negative.")
+    }
+    if timeoutBackoff < 1 {
+        log.Fatal("ERROR: --timeout_backoff_factor must be at least 1.")
+    }
+    if preflightReadFiles < 0 {
+        log.Fatal("ERROR: --preflight_read_test must not be negative.")
+    }
+    if maxNotebookDepth < 0 {
+        log.Fatal("ERROR: --max_notebook_depth must not be negative.")
+    }
+    if maxNotebookDepthAction != "flatten" && maxNotebookDepthAction != "abort" {
+        log.Fatalf("ERROR: --max_notebook_depth_action must be flatten or abort, got %q.", maxNotebookDepthAction)
+    }
 
-func main() {
-    log.SetFlags(0)
+    if onConflict != "overwrite" && onConflict != "skip" {
+        log.Fatalf("ERROR: --on_conflict must be overwrite or skip, got %q.", onConflict)
+    }
+    if onConflict == "skip" && contentAddressed {
+        log.Fatal("ERROR: --on_conflict=skip cannot be combined with --content_addressed, whose notes are never updated.")
+    }
 
-    var notebookId string
-    var directory string
-    var fileExtension string
+    switch onClockSkew {
+    case "ignore", "warn", "abort":
+    default:
+        log.Fatalf("ERROR: --on_clock_skew must be ignore, warn or abort, got %q.", onClockSkew)
+    }
 
-    flag.StringVar(&notebookId, "notebook_id", "", "Joplin notebook (folder) ID")
-    flag.StringVar(&directory, "directory", "", "Directory to scan for files")
-    flag.StringVar(&fileExtension, "file_extension", ".smmx", "File extension filter (e.g. .smmx)")
+    if sidecarIDs && contentAddressed {
+        log.Fatal("ERROR: --sidecar_ids cannot be combined with --content_addressed, whose notes are never updated.")
+    }
+    if checkNoteCount && mirrorTree {
+        log.Fatal("ERROR: --check_note_count cannot be combined with --mirror_tree; notes are spread over several notebooks.")
+    }
+    if rate < 0 {
+        log.Fatal("ERROR: --rate must not be negative.")
+    }
+    if noteCountTolerance < 0 {
+        log.Fatal("ERROR: --note_count_tolerance must not be negative.")
+    }
+    if lazyBodies && (audit || dedupe || reportDrift || prune) {
+        log.Fatal("ERROR: --lazy_bodies cannot be combined with --audit, --dedupe, --report_drift or --prune, which read every note's body.")
+    }
+    if prune && (mirrorTree || contentAddressed) {
+        log.Fatal("ERROR: --prune cannot be combined with --mirror_tree or --content_addressed.")
+    }
+    if reportDrift && (mirrorTree || contentAddressed) {
+        log.Fatal("ERROR: --report_drift cannot be combined with --mirror_tree or --content_addressed.")
+    }
+    if serverMode && (resourceRefs || cleanupOrphans) {
+        log.Fatal("ERROR: --resource_refs_report and --cleanup_orphans are not supported in server mode.")
+    }
+    if serverMode && mirrorTree {
+        log.Fatal("ERROR: --mirror_tree is not supported in server mode.")
+    }
 
-    flag.Parse()
+    // ctx is cancelled only when the shutdown grace period runs out; it aborts in-flight requests.
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
 
-    token := os.Getenv("JOPLIN_TOKEN")
-    if token == "" {
-        log.Fatal("ERROR: Environment variable JOPLIN_TOKEN is not set or empty.")
+    clientOpts := []joplin.ClientOption{joplin.WithTimeout(httpTimeout), joplin.WithRetries(retries), joplin.WithUserAgent("go-joplin-file-backup"), joplin.WithRate(rate)}
+    if authMode == "header" {
+        clientOpts = append(clientOpts, joplin.WithBearerAuth())
+    }
+    var client *joplin.Client
+    if serverMode {
+        client = joplin.NewClient(serverURL, "", clientOpts...)
+    } else {
+        client = joplin.NewClient(apiBase, token, clientOpts...)
+    }
+    client.Budget = joplin.NewRetryBudget(retryBudgetSize)
+    client.StrictDecode = strictDecode
+    client.OpenFiles = joplin.NewFileLimiter(maxOpenFiles)
+    client.TimeoutBackoff = timeoutBackoff
+    client.ResourceMime = resourceMime
+
+    if serverMode {
+        if err := client.Login(ctx, serverEmail, serverPassword); err != nil {
+            log.Fatalf("failed to log in to Joplin Server %s: %v", serverURL, err)
+        }
     }
 
-    dirInfo, err := os.Stat(directory)
-    if err != nil {
-        log.Fatalf("cannot stat directory %q: %v", directory, err)
+    if latency, info, err := client.PingDetailed(ctx); err != nil {
+        log.Printf("WARNING: Joplin /ping failed: %v (continuing anyway)", err)
+    } else if verbose {
+        log.Printf("Connected to Joplin (%s): %s", latency.Round(time.Millisecond), info)
     }
-    if !dirInfo.IsDir() {
-        log.Fatalf("%q is not a directory", directory)
+
+    // /ping needs no token, so check it explicitly before anything else depends on it.
+    if err := client.CheckAuth(ctx); errors.Is(err, joplin.ErrAuth) {
+        log.Fatalf("ERROR: %v; check JOPLIN_TOKEN or --token_file (or the server credentials)", err)
+    } else if err != nil {
+        log.Printf("WARNING: cannot verify the Joplin token: %v (continuing anyway)", err)
     }
 
-    client := NewClient(JOPLIN_API_BASE, token)
+    if onClockSkew != "ignore" {
+        skew, err := client.ClockSkew(ctx)
+        switch {
+        case err != nil:
+            log.Printf("WARNING: cannot check clock skew against Joplin: %v", err)
+        case skew.Abs() > maxClockSkew && onClockSkew == "abort":
+            log.Fatalf("ERROR: local clock differs from the Joplin host by %s (more than --max_clock_skew=%s); fix the system clock or pass --on_clock_skew=warn.", skew.Round(time.Second), maxClockSkew)
+        case skew.Abs() > maxClockSkew:
+            log.Printf("WARNING: local clock differs from the Joplin host by %s; upload_at and other timestamps may be wrong", skew.Round(time.Second))
+        }
+    }
 
-    if err := client.Ping(); err != nil {
-        log.Printf("WARNING: Joplin /ping failed: %v (continuing anyway)", err)
+    notebookCreated := false
+    if notebookName != "" {
+        notebookId, err = client.ChildFolderIDByName(ctx, notebookName, parentNotebookId)
+        switch {
+        case errors.Is(err, joplin.ErrNotFound) && createNotebook && (dryRun || dryRunDiff):
+            notebookId, notebookCreated = previewNotebookPrefix+notebookName, true
+            fmt.Fprintf(os.Stdout, "  would create notebook %q\n", notebookName)
+        case errors.Is(err, joplin.ErrNotFound) && createNotebook:
+            notebookId, err = client.CreateFolder(ctx, notebookName, parentNotebookId)
+            if err != nil {
+                log.Fatalf("ERROR: cannot create notebook %q: %v", notebookName, err)
+            }
+            notebookCreated = true
+            fmt.Fprintf(os.Stdout, "Created notebook %q (%s)\n", notebookName, notebookId)
+        case errors.Is(err, joplin.ErrNotFound):
+            log.Fatalf("ERROR: no notebook is named %q; check --notebook_name or pass --create_notebook.", notebookName)
+        case err != nil:
+            log.Fatalf("ERROR: cannot resolve --notebook_name: %v", err)
+        }
+        if verbose && !notebookCreated {
+            log.Printf("Notebook %q resolved to %s", notebookName, notebookId)
+        }
     }
 
-    notesByTitle, err := client.NotesByTitle(notebookId)
-    if err != nil {
-        log.Fatalf("failed to load notes from notebook %s: %v", notebookId, err)
+    if requireNotebook && !notebookCreated {
+        if _, err := client.Folder(ctx, notebookId); errors.Is(err, joplin.ErrNotFound) {
+            log.Fatalf("ERROR: notebook %s does not exist; check --notebook_id.", notebookId)
+        } else if err != nil {
+            log.Printf("WARNING: cannot verify that notebook %s exists: %v", notebookId, err)
+        }
+    }
+
+    notesByTitle := map[string]joplin.Note{}
+    if !notebookCreated {
+        load := client.NotesByTitleMulti
+        if lazyBodies {
+            load = client.NoteTitlesMulti
+        }
+        multi, err := load(ctx, notebookId)
+        if err != nil {
+            log.Fatalf("failed to load notes from notebook %s: %v", notebookId, err)
+        }
+        shared := 0
+        for _, notes := range multi {
+            if len(notes) > 1 {
+                shared++
+            }
+        }
+        if shared > 0 {
+            log.Printf("WARNING: %d titles are shared by several notes in notebook %s; only the oldest note of each is updated (see --collision_report)", shared, notebookId)
+        }
+        notesByTitle = joplin.OldestByTitle(multi)
+    }
+
+    // Counted separately, since notesByTitle folds notes sharing a title.
+    notesBefore := 0
+    if checkNoteCount && !dryRun && !dryRunDiff {
+        notesBefore, err = client.NoteCount(ctx, notebookId)
+        if err != nil {
+            log.Fatalf("failed to count notes in notebook %s: %v", notebookId, err)
+        }
     }
 
-    fmt.Printf("Existing notes in notebook %s: %d\n", notebookId, len(notesByTitle))
+    r := &runner{
+        client:         client,
+        started:        started,
+        lazyBodies:     lazyBodies,
+        root:           directory,
+        mirrorTree:     mirrorTree,
+        notebookId:     notebookId,
+        notesByTitle:   notesByTitle,
+        out:            os.Stdout,
+        outputTemplate: outputTmpl,
+        bodyTemplate:   bodyTmpl,
+        companionExts:  companionExts,
+        fsyncState:     fsyncState,
+        sidecarSuffix:  sidecarSuffix,
+
+        autoTagByExtension:   autoTagByExtension,
+        tag:                  strings.TrimSpace(tag),
+        indexTitle:           indexTitle,
+        contentAddressed:     contentAddressed,
+        onlyIfChanged:        onlyIfChanged,
+        perFileTimeout:       perFileTimeout,
+        orderByCreated:       orderByCreated,
+        repair:               repair,
+        cleanupSem:           make(chan struct{}, cleanupConcurrency),
+        onUnreadable:         onUnreadable,
+        sidecarIDs:           sidecarIDs,
+        skipConflicts:        onConflict == "skip",
+        maxNotebookDepth:     maxNotebookDepth,
+        abortOnMaxDepth:      maxNotebookDepthAction == "abort",
+        uniqueResourceTitles: resourceTitleDedupSuffix,
+        titleMap:             titleMap,
+        stateFile:            stateFile,
+        trustMtime:           trustMtime,
+        preview:              dryRun || dryRunDiff,
+        showDiff:             dryRunDiff,
+        externalizeAbove:     externalizeLimit,
+        externalStore:        externalStore,
+        externalURLBase:      externalURLBase,
+        twoPhase:             twoPhase,
+        verify:               verify,
+        verifySize:           verifySize,
+        twoPhaseTimeout:      twoPhaseTimeout,
+    }
+    if includeGit {
+        if r.git, err = loadGitInfo(directory); err != nil {
+            log.Printf("WARNING: --include_git: no git information is recorded: %v", err)
+        }
+    }
+    if jsonStream {
+        // Keep stdout clean for the NDJSON records.
+        r.out = os.Stderr
+        r.stream = json.NewEncoder(os.Stdout)
+    }
+    if logFormat == "json" {
+        if r.stream == nil {
+            r.stream = json.NewEncoder(os.Stdout)
+        }
+        r.out = newJSONLineWriter(r.out)
+        r.jsonLog = true
+    }
+
+    fmt.Fprintf(r.out, "Existing notes in notebook %s: %d\n", notebookId, len(notesByTitle))
+
+    if audit {
+        if stats := r.audit(ctx); stats.Mismatch > 0 || stats.Errors > 0 {
+            os.Exit(1)
+        }
+        return
+    }
+
+    if listNotes {
+        if _, err := r.listNotes(ctx); err != nil {
+            log.Fatalf("listing notes failed: %v", err)
+        }
+        return
+    }
+
+    if collisionReport {
+        if _, _, err := r.collisionReport(ctx, directory, descend, wanted); err != nil {
+            log.Fatalf("collision report failed: %v", err)
+        }
+        return
+    }
 
-    lowerExt := strings.ToLower(fileExtension)
+    if resourceRefs {
+        if _, _, err := r.resourceRefsReport(ctx); err != nil {
+            log.Fatalf("resource reference report failed: %v", err)
+        }
+        return
+    }
 
-    err = filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+    if cleanupOrphans {
+        _, failed, err := r.cleanupOrphans(ctx, dryRun)
         if err != nil {
-            log.Printf("walk error on %s: %v", path, err)
-            return nil
+            log.Fatalf("orphan cleanup failed: %v", err)
         }
-        if info.IsDir() {
-            return nil
+        if failed > 0 {
+            os.Exit(1)
         }
-        if strings.ToLower(filepath.Ext(info.Name())) != lowerExt {
-            return nil
+        return
+    }
+
+    if reportDrift {
+        if _, err := r.reportDrift(directory, descend, wanted); err != nil {
+            log.Fatalf("drift report failed: %v", err)
         }
+        return
+    }
 
-        createdAt := fileCreatedAt(info)
-        createdAtUTC := createdAt.UTC()
-        title := info.Name()
+    if dedupe {
+        deleted, failed := r.dedupe(ctx, dryRun)
+        if deleted > 0 && indexTitle != "" {
+            if err := r.updateIndexNote(ctx); err != nil {
+                log.Printf("ERROR: %v", err)
+            }
+        }
+        if failed > 0 {
+            os.Exit(1)
+        }
+        return
+    }
 
-        // Save the old resource ID for this note (if it exists)
-        var oldResourceIDs []string
-        var noteID string
-        if note, ok := notesByTitle[title]; ok {
-            noteID = note.ID
-            oldResourceIDs = extractResourceIDs(note.Body)
+    if preflightReadFiles > 0 {
+        read, err := preflightReadTest(directory, descend, wanted, preflightReadFiles)
+        if err != nil {
+            log.Fatalf("ERROR: preflight read test failed, the source storage may be failing; nothing was uploaded: %v", err)
         }
+        fmt.Fprintf(r.out, "Preflight read test: %d files read without errors\n", read)
+    }
 
-        // Loading a new resource
-        res, err := client.UploadResource(path, title)
+    if stateFile != "" && !r.preview {
+        if err := r.startRun(); err != nil {
+            log.Fatalf("ERROR: %v", err)
+        }
+    }
+
+    walkDone := make(chan struct{})
+    sigs := make(chan os.Signal, 1)
+    signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+    go func() {
+        select {
+        case sig := <-sigs:
+            log.Printf("received %s: finishing the in-flight file (grace period %s); send again to abort immediately", sig, shutdownGrace)
+            r.stopping.Store(true)
+            select {
+            case <-walkDone:
+            case <-time.After(shutdownGrace):
+                log.Printf("shutdown grace period expired, cancelling in-flight requests")
+                cancel()
+            case <-sigs:
+                log.Printf("second signal received, cancelling in-flight requests")
+                cancel()
+            }
+        case <-walkDone:
+        }
+    }()
+
+    realRoot := directory
+    if restrictToRoot {
+        realRoot, err = filepath.EvalSymlinks(directory)
         if err != nil {
-            log.Printf("ERROR uploading resource for %s: %v", path, err)
-            return nil
+            log.Fatalf("cannot resolve directory %q: %v", directory, err)
         }
+    }
 
-        createdAtStr := createdAt.Format("2006-01-02 15:04:05.000 -0700")
-        uploadAt := time.Now()
-        uploadAtStr := uploadAt.Format("2006-01-02 15:04:05.000 -0700")
+    // handle reports the outcome of one file or empty directory marker; a non-nil error aborts the run.
+    handle := func(path string, result fileResult) error {
+        switch result.Status {
+        case "unreadable":
+            return r.unreadable(path, result.err)
+        case "vanished":
+            r.vanished(path, result.err)
+            return nil
+        }
+        r.report(result)
+        if result.Status != "error" {
+            r.fileDone(result)
+        }
+        if errors.Is(result.err, joplin.ErrRetryBudgetExhausted) || errors.Is(result.err, errMaxNotebookDepth) {
+            return result.err
+        }
+        if failFast && result.Status == "error" {
+            return fmt.Errorf("%w: %s: %v", errFailFast, path, result.err)
+        }
+        return nil
+    }
 
-        body := fmt.Sprintf(
-            "created_at: %q\n"+
-                "upload_at: %q\n"+
-                "file_path: %q\n\n"+
-                "[%s](:/%s)\n",
-            createdAtStr,
-            uploadAtStr,
-            path,
-            title,
-            res.ID,
-        )
-
-        status := "added"
-        if noteID != "" {
-            // Update an existing note
-            if err := client.UpdateNote(noteID, notebookId, title, body); err != nil {
-                log.Printf("ERROR updating note for %s: %v", path, err)
-            } else {
-                status = "updated"
-
-                // After successful update - delete old resources
-                for _, rid := range oldResourceIDs {
-                    if rid == res.ID {
-                        continue
-                    }
-                    if err := client.DeleteResource(rid); err != nil {
-                        log.Printf("WARNING: failed to delete old resource %s for %s: %v", rid, path, err)
-                    } else {
-                        fmt.Printf("  cleaned old resource %s for %s\n", rid, path)
-                    }
-                }
+    // skippedOld counts the files left out by --since.
+    skippedOld := 0
+    // With --concurrency > 1 the walk only collects the files; they are processed after it.
+    var pending []pendingFile
+    // seenTitles collects the note titles of all files found, for --prune.
+    seenTitles := make(map[string]bool)
+    walkFn := func(path string, info os.FileInfo, err error) error {
+        if r.stopping.Load() {
+            return filepath.SkipAll
+        }
+        if errors.Is(err, fs.ErrNotExist) {
+            r.vanished(path, err)
+            return nil
+        }
+        if err != nil {
+            return r.unreadable(path, err)
+        }
+        if info.IsDir() {
+            if !descend(path) {
+                return filepath.SkipDir
+            }
+            if emptyDirMarkers && !r.preview && path != directory && isEmptyDir(path) {
+                result := r.markEmptyDir(ctx, path, info)
+                seenTitles[result.Title] = true
+                return handle(path, result)
             }
-        } else {
-            // Create a new note
-            note, err := client.CreateNote(notebookId, title, body)
+            return nil
+        }
+        if !wanted(path, info) {
+            return nil
+        }
+        name, _ := sanitizeUTF8(info.Name())
+        seenTitles[r.noteTitle(path, name)] = true
+        if restrictToRoot && info.Mode()&os.ModeSymlink != 0 {
+            ok, err := withinRoot(realRoot, path)
             if err != nil {
-                log.Printf("ERROR creating note for %s: %v", path, err)
-            } else {
-                notesByTitle[title] = *note
+                log.Printf("WARNING: skipping %s: cannot resolve symlink: %v", path, err)
+                return nil
+            }
+            if !ok {
+                log.Printf("WARNING: skipping %s: symlink target is outside %s", path, directory)
+                return nil
             }
         }
+        if indexTitle != "" && info.Name() == indexTitle {
+            log.Printf("WARNING: skipping %s: its name collides with the index note title", path)
+            return nil
+        }
+        if r.resumeDone[path] {
+            return nil
+        }
+        if !sinceCutoff.IsZero() && info.ModTime().Before(sinceCutoff) {
+            skippedOld++
+            return nil
+        }
 
-        fmt.Printf(
-            "%s | created_at_utc=%s | status=%s\n",
-            path,
-            createdAtUTC.Format(time.RFC3339Nano),
-            status,
-        )
+        if concurrency > 1 {
+            pending = append(pending, pendingFile{path: path, info: info})
+            return nil
+        }
+        return handle(path, r.processFile(ctx, path, info))
+    }
+    // processPending backs up the files collected by the last walk when running concurrently.
+    processPending := func() error {
+        files := pending
+        pending = nil
+        return r.processAll(ctx, files, concurrency, handle)
+    }
 
-        return nil
-    })
+    err = filepath.Walk(directory, walkFn)
+    if err == nil {
+        err = processPending()
+    }
 
+    if err == nil && retryVanished && len(r.vanishedPaths) > 0 {
+        // Paths that were replaced rather than removed (e.g. a directory renamed into place) exist again.
+        r.rescanning = true
+        for _, path := range r.vanishedPaths {
+            if r.stopping.Load() {
+                break
+            }
+            if _, statErr := os.Lstat(path); statErr != nil {
+                continue
+            }
+            fmt.Fprintf(r.out, "  re-scanning %s\n", path)
+            r.stats.Vanished--
+            if err = filepath.Walk(path, walkFn); err == nil {
+                err = processPending()
+            }
+            if err != nil {
+                break
+            }
+        }
+    }
+    close(walkDone)
+    r.flushRunState()
+    if !sinceCutoff.IsZero() {
+        fmt.Fprintf(r.out, "Skipped %d files not modified since %s (--since)\n", skippedOld, sinceCutoff.Format(time.RFC3339))
+    }
+
+    if errors.Is(err, joplin.ErrRetryBudgetExhausted) {
+        r.summary("Aborted, partial summary")
+        log.Fatalf("aborting: %v; the Joplin API appears to be unavailable", err)
+    }
+    if errors.Is(err, errMaxNotebookDepth) {
+        r.summary("Aborted, partial summary")
+        log.Fatalf("aborting: %v", err)
+    }
+    if errors.Is(err, errUnreadable) {
+        r.summary("Aborted, partial summary")
+        log.Fatalf("aborting: %v (--on_unreadable=fail)", err)
+    }
+    if errors.Is(err, errFailFast) {
+        r.summary("Aborted, partial summary")
+        log.Fatalf("aborting: %v (--fail_fast)", err)
+    }
     if err != nil {
         log.Fatalf("scan error: %v", err)
     }
+
+    if r.stopping.Load() {
+        r.summary("Interrupted, partial summary")
+        os.Exit(1)
+    }
+
+    pruned, pruneFailed := 0, 0
+    if prune && (r.stats.Unreadable > 0 || r.stats.Vanished > 0) {
+        log.Printf("WARNING: not pruning: some files or directories could not be scanned, so their notes would be deleted")
+    } else if prune {
+        pruned, pruneFailed = r.prune(ctx, seenTitles)
+    }
+
+    indexCreated := false
+    if indexTitle != "" && !r.preview {
+        _, hadIndex := r.notesByTitle[indexTitle]
+        if err := r.updateIndexNote(ctx); err != nil {
+            log.Printf("ERROR: %v", err)
+        }
+        _, hasIndex := r.notesByTitle[indexTitle]
+        indexCreated = !hadIndex && hasIndex
+    }
+
+    countMismatch := false
+    if checkNoteCount && !r.preview {
+        delta := r.stats.Added - pruned
+        if indexCreated {
+            delta++
+        }
+        countMismatch = !r.checkNoteCount(ctx, notesBefore, delta, noteCountTolerance)
+    }
+
+    r.completeRun()
+
+    r.summary("Summary")
+    if r.stats.Unreadable > 0 && onUnreadable == "warn" {
+        log.Printf("WARNING: %d unreadable files or directories were not backed up", r.stats.Unreadable)
+    }
+    if r.stats.Vanished > 0 {
+        log.Printf("WARNING: %d files or directories vanished during the scan and were not backed up", r.stats.Vanished)
+    }
+    if r.stats.Errors > 0 {
+        log.Printf("ERROR: %d files could not be backed up", r.stats.Errors)
+    }
+    if r.stats.Errors > 0 || pruneFailed > 0 || (countMismatch && strict) {
+        os.Exit(1)
+    }
 }
@@ -0,0 +1,42 @@
+package main
+
+import (
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestExtractResourceIDs(t *testing.T) {
+    a := "0123456789abcdef0123456789abcdef"
+    b := strings.Repeat("f", 32)
+    upper := "0123456789ABCDEF0123456789ABCDEF"
+    tests := []struct {
+        name string
+        body string
+        want []string
+    }{
+        {"plain link", "[map.smmx](:/" + a + ")", []string{a}},
+        {"title", "[map.smmx](:/" + a + ` "Map")`, []string{a}},
+        {"anchor", "[map.smmx](:/" + a + "#section)", []string{a}},
+        {"query string", "[map.smmx](:/" + a + "?download=1)", []string{a}},
+        {"uppercase hex", "[map.smmx](:/" + upper + ")", []string{upper}},
+        {"parentheses in link text", "[map (1).smmx](:/" + a + ")", []string{a}},
+        {"several links on one line", "[a](:/" + a + ") and [b](:/" + b + ")", []string{a, b}},
+        {"metadata before link", "sha256: \"x\"\n\n[map.smmx](:/" + a + ")\n", []string{a}},
+        {"img src", `<img src=":/` + a + `" width="300">`, []string{a}},
+        {"a href", `<a href=":/` + a + `">map</a>`, []string{a}},
+        {"single quotes", `<img src=':/` + a + `'>`, []string{a}},
+        {"markdown and HTML", "[a](:/" + a + `) <img src=":/` + b + `"/>`, []string{a, b}},
+        {"HTML web link", `<a href="https://example.com/` + a + `">`, nil},
+        {"too short", "[x](:/" + a[:31] + ")", nil},
+        {"too long", "[x](:/" + a + "0)", nil},
+        {"not hex", "[x](:/" + strings.Repeat("g", 32) + ")", nil},
+        {"web link", "[x](https://example.com/" + a + ")", nil},
+        {"no links", "just text", nil},
+    }
+    for _, tt := range tests {
+        if got := extractResourceIDs(tt.body); !reflect.DeepEqual(got, tt.want) {
+            t.Errorf("%s: extractResourceIDs(%q) = %v, want %v", tt.name, tt.body, got, tt.want)
+        }
+    }
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "path/filepath"
+    "strings"
+
+    "github.com/volodymyroliinyk/go-joplin-file-backup/joplin"
+)
+
+// errMaxNotebookDepth is returned by notebookFor when a directory is nested deeper than --max_notebook_depth
+// and the configured action is to abort.
+var errMaxNotebookDepth = errors.New("directory exceeds --max_notebook_depth")
+
+// notebookFor returns the notebook a file belongs to in mirror-tree mode: the sub-notebook chain
+// matching the file's directory relative to the scan root, created on demand.
+// Directory levels beyond --max_notebook_depth are flattened into titlePrefix ("c/d/"), which the
+// caller puts in front of the note title, unless the run is configured to abort instead.
+func (r *runner) notebookFor(ctx context.Context, path string) (notebookID, titlePrefix string, err error) {
+    r.cacheMu.Lock()
+    defer r.cacheMu.Unlock()
+
+    rel, err := filepath.Rel(r.root, filepath.Dir(path))
+    if err != nil {
+        return "", "", fmt.Errorf("relative path: %w", err)
+    }
+    if rel == "." {
+        return r.notebookId, "", nil
+    }
+
+    parts := strings.Split(rel, string(filepath.Separator))
+    if r.maxNotebookDepth > 0 && len(parts) > r.maxNotebookDepth {
+        if r.abortOnMaxDepth {
+            return "", "", fmt.Errorf("%w (%d): %s is %d levels deep", errMaxNotebookDepth, r.maxNotebookDepth, rel, len(parts))
+        }
+        titlePrefix = strings.Join(parts[r.maxNotebookDepth:], "/") + "/"
+        parts = parts[:r.maxNotebookDepth]
+        rel = filepath.Join(parts...)
+    }
+
+    if r.notebookIDs == nil {
+        folders, err := r.client.Folders(ctx)
+        if err != nil {
+            return "", "", err
+        }
+        r.folders = folders
+        r.notebookIDs = map[string]string{".": r.notebookId}
+    }
+
+    if id, ok := r.notebookIDs[rel]; ok {
+        return id, titlePrefix, nil
+    }
+
+    parentID := r.notebookId
+    current := "."
+    for _, part := range parts {
+        current = filepath.Join(current, part)
+        if id, ok := r.notebookIDs[current]; ok {
+            parentID = id
+            continue
+        }
+
+        id := r.childNotebook(parentID, part)
+        if id == "" && r.preview {
+            id = previewNotebookPrefix + current
+            fmt.Fprintf(r.out, "  would create notebook %s\n", current)
+        } else if id == "" {
+            folder, err := r.client.CreateNotebook(ctx, part, parentID)
+            if err != nil {
+                return "", "", fmt.Errorf("create notebook %q: %w", current, err)
+            }
+            r.folders = append(r.folders, *folder)
+            id = folder.ID
+            fmt.Fprintf(r.out, "  created notebook %s\n", current)
+        }
+
+        r.notebookIDs[current] = id
+        parentID = id
+    }
+
+    return parentID, titlePrefix, nil
+}
+
+// childNotebook returns the ID of an existing sub-notebook with the given title, or "".
+func (r *runner) childNotebook(parentID, title string) string {
+    for _, f := range r.folders {
+        if f.ParentID == parentID && f.Title == title {
+            return f.ID
+        }
+    }
+    return ""
+}
+
+// notesIn returns the notes of a notebook by title, loading them on first use.
+// The returned map is shared: access it through cachedNote and cacheNote.
+func (r *runner) notesIn(ctx context.Context, notebookID string) (map[string]joplin.Note, error) {
+    r.cacheMu.Lock()
+    defer r.cacheMu.Unlock()
+
+    if notebookID == r.notebookId {
+        return r.notesByTitle, nil
+    }
+    if notes, ok := r.notebookNotes[notebookID]; ok {
+        return notes, nil
+    }
+
+    notes := map[string]joplin.Note{}
+    if !strings.HasPrefix(notebookID, previewNotebookPrefix) {
+        load := r.client.NotesByTitleMulti
+        if r.lazyBodies {
+            load = r.client.NoteTitlesMulti
+        }
+        multi, err := load(ctx, notebookID)
+        if err != nil {
+            return nil, fmt.Errorf("load notes of notebook %s: %w", notebookID, err)
+        }
+        notes = joplin.OldestByTitle(multi)
+    }
+    if r.notebookNotes == nil {
+        r.notebookNotes = make(map[string]map[string]joplin.Note)
+    }
+    r.notebookNotes[notebookID] = notes
+    return notes, nil
+}
+
+// cachedNote looks up a note by title in a map returned by notesIn.
+func (r *runner) cachedNote(notes map[string]joplin.Note, title string) (joplin.Note, bool) {
+    r.cacheMu.Lock()
+    defer r.cacheMu.Unlock()
+    note, ok := notes[title]
+    return note, ok
+}
+
+// withBody returns note with its body, fetching it if the note was listed without one (--lazy_bodies)
+// and caching the result in notes, a map returned by notesIn.
+func (r *runner) withBody(ctx context.Context, notes map[string]joplin.Note, note joplin.Note) (joplin.Note, error) {
+    if !note.Partial {
+        return note, nil
+    }
+    full, err := r.client.GetNote(ctx, note.ID)
+    if err != nil {
+        return note, err
+    }
+    full.CreatedTime = note.CreatedTime
+
+    r.cacheMu.Lock()
+    defer r.cacheMu.Unlock()
+    if notes[note.Title].ID == note.ID {
+        notes[note.Title] = *full
+    }
+    return *full, nil
+}
+
+// cacheNote records a created or updated note under title in a map returned by notesIn. oldTitle, if set,
+// is the title the note had before; it is dropped unless it now belongs to another note.
+func (r *runner) cacheNote(notes map[string]joplin.Note, title, oldTitle string, note joplin.Note) {
+    r.cacheMu.Lock()
+    defer r.cacheMu.Unlock()
+    if oldTitle != "" && notes[oldTitle].ID == note.ID {
+        delete(notes, oldTitle)
+    }
+    notes[title] = note
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+    "context"
+    "log"
+)
+
+// checkNoteCount compares the notebook's note count after the run with the count before it plus the
+// changes the run reported (delta: notes created minus notes pruned). A difference of more than
+// tolerance points at duplicate creation or at someone else changing the notebook during the run,
+// and is logged prominently. It reports whether the count was as expected; a count that cannot be
+// fetched is logged and not treated as a mismatch.
+func (r *runner) checkNoteCount(ctx context.Context, before, delta, tolerance int) bool {
+    after, err := r.client.NoteCount(ctx, r.notebookId)
+    if err != nil {
+        log.Printf("WARNING: cannot check the note count of notebook %s: %v", r.notebookId, err)
+        return true
+    }
+
+    expected := before + delta
+    diff := after - expected
+    if diff < 0 {
+        diff = -diff
+    }
+    if diff <= tolerance {
+        return true
+    }
+
+    log.Printf("WARNING: NOTE COUNT MISMATCH: notebook %s has %d notes, expected %d (%d before the run, %+d reported by it); "+
+        "check for duplicate notes (--dedupe) or changes made to the notebook during the run",
+        r.notebookId, after, expected, before, delta)
+    return false
+}
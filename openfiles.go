@@ -0,0 +1,14 @@
+package main
+
+import "syscall"
+
+// defaultMaxOpenFiles returns a quarter of the soft RLIMIT_NOFILE, leaving the rest for HTTP
+// connections, state files and the runtime. It returns 0 (unlimited) if the limit is unknown;
+// an unlimited rlimit is capped like any other large one.
+func defaultMaxOpenFiles() int {
+    var lim syscall.Rlimit
+    if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil {
+        return 0
+    }
+    return max(1, int(min(lim.Cur/4, 1<<20)))
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "text/template"
+    "time"
+)
+
+// defaultOutputTemplate reproduces the classic per-file status line.
+const defaultOutputTemplate = "{{.Path}} | created_at_utc={{.CreatedAtUTC}} | status={{.Status}}"
+
+// templateFuncs are the helper functions available in user-supplied templates.
+var templateFuncs = template.FuncMap{
+    "humanSize":  humanSize,
+    "formatTime": formatTime,
+    "basename":   filepath.Base,
+    "dir":        filepath.Dir,
+    "env":        os.Getenv,
+}
+
+// humanSize formats a byte count with a decimal unit, e.g. 1234567 → "1.2 MB".
+func humanSize(n int64) string {
+    const unit = 1000
+    if n < unit {
+        return fmt.Sprintf("%d B", n)
+    }
+    div, exp := int64(unit), 0
+    for m := n / unit; m >= unit; m /= unit {
+        div *= unit
+        exp++
+    }
+    return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
+
+// formatTime formats a time.Time, or an RFC 3339 string such as .CreatedAtUTC, with a Go time layout.
+// Meant for pipelines: {{ .CreatedAtUTC | formatTime "2006-01-02" }}.
+func formatTime(layout string, value any) (string, error) {
+    switch v := value.(type) {
+    case time.Time:
+        return v.Format(layout), nil
+    case string:
+        t, err := time.Parse(time.RFC3339Nano, v)
+        if err != nil {
+            return "", fmt.Errorf("formatTime: %w", err)
+        }
+        return t.Format(layout), nil
+    default:
+        return "", fmt.Errorf("formatTime: unsupported value of type %T", value)
+    }
+}
+
+// parseOutputTemplate compiles the per-file output template and renders it once against a sample
+// result, so unknown fields or bad syntax fail at startup instead of in the middle of a run.
+func parseOutputTemplate(text string) (*template.Template, error) {
+    tmpl, err := template.New("output").Option("missingkey=error").Funcs(templateFuncs).Parse(text)
+    if err != nil {
+        return nil, fmt.Errorf("parse output template: %w", err)
+    }
+
+    sample := fileResult{Path: "/dir/file.ext", Title: "file.ext", Status: "added", CreatedAtUTC: "2006-01-02T15:04:05Z"}
+    if err := tmpl.Execute(io.Discard, sample); err != nil {
+        return nil, fmt.Errorf("render output template: %w", err)
+    }
+
+    return tmpl, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+    "context"
+    "os"
+    "sync"
+    "sync/atomic"
+)
+
+// pendingFile is a file selected by the walk, waiting to be backed up.
+type pendingFile struct {
+    path string
+    info os.FileInfo
+}
+
+// processedFile pairs a file with the outcome of processFile.
+type processedFile struct {
+    path   string
+    result fileResult
+}
+
+// keyedMutex hands out one lock per key, so files mapping to the same note are processed one at a time
+// while unrelated files proceed in parallel. The zero value is ready to use.
+type keyedMutex struct {
+    mu    sync.Mutex
+    locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+    sync.Mutex
+    // users counts the holders and waiters; the lock is dropped from the map when it reaches zero.
+    users int
+}
+
+// lock locks key and returns the function that unlocks it.
+func (k *keyedMutex) lock(key string) func() {
+    k.mu.Lock()
+    if k.locks == nil {
+        k.locks = make(map[string]*keyedLock)
+    }
+    l, ok := k.locks[key]
+    if !ok {
+        l = &keyedLock{}
+        k.locks[key] = l
+    }
+    l.users++
+    k.mu.Unlock()
+
+    l.Lock()
+    return func() {
+        l.Unlock()
+        k.mu.Lock()
+        if l.users--; l.users == 0 {
+            delete(k.locks, key)
+        }
+        k.mu.Unlock()
+    }
+}
+
+// processAll backs up files with up to workers of them in flight. Results are passed to handle one at a
+// time, in completion order, from the calling goroutine, so reporting and run state need no locking.
+// The first error returned by handle stops further files from being started; the in-flight ones are
+// still handled and the error is returned once they finish.
+func (r *runner) processAll(ctx context.Context, files []pendingFile, workers int, handle func(path string, result fileResult) error) error {
+    jobs := make(chan pendingFile)
+    results := make(chan processedFile)
+
+    var stop atomic.Bool
+    go func() {
+        defer close(jobs)
+        for _, f := range files {
+            if stop.Load() || r.stopping.Load() {
+                return
+            }
+            jobs <- f
+        }
+    }()
+
+    var wg sync.WaitGroup
+    for range workers {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for f := range jobs {
+                results <- processedFile{path: f.path, result: r.processFile(ctx, f.path, f.info)}
+            }
+        }()
+    }
+    go func() {
+        wg.Wait()
+        close(results)
+    }()
+
+    var firstErr error
+    for p := range results {
+        if err := handle(p.path, p.result); err != nil && firstErr == nil {
+            firstErr = err
+            stop.Store(true)
+        }
+    }
+    return firstErr
+}
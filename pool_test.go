@@ -0,0 +1,52 @@
+package main
+
+import (
+    "context"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+// Files in different directories share a title; concurrent workers must update one note, not create two.
+func TestProcessAllSameTitleCreatesOneNote(t *testing.T) {
+    s := newStubJoplin(t)
+    s.createDelay = 50 * time.Millisecond
+    root := t.TempDir()
+
+    var files []pendingFile
+    for _, dir := range []string{"a", "b"} {
+        path := filepath.Join(root, dir, "map.smmx")
+        if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+            t.Fatal(err)
+        }
+        if err := os.WriteFile(path, []byte("content of "+dir), 0o644); err != nil {
+            t.Fatal(err)
+        }
+        info, err := os.Stat(path)
+        if err != nil {
+            t.Fatal(err)
+        }
+        files = append(files, pendingFile{path: path, info: info})
+    }
+
+    r := newTestRunner(s, root)
+    statuses := map[string]int{}
+    err := r.processAll(context.Background(), files, 4, func(path string, result fileResult) error {
+        if result.err != nil {
+            t.Errorf("%s: %v", path, result.err)
+        }
+        statuses[result.Status]++
+        return nil
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if notes := s.notesTitled("map.smmx"); len(notes) != 1 {
+        t.Fatalf("got %d notes titled map.smmx, want 1", len(notes))
+    }
+    if statuses["added"] != 1 || statuses["updated"] != 1 {
+        t.Errorf("statuses = %v, want one added and one updated", statuses)
+    }
+}
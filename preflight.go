@@ -0,0 +1,71 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "io/fs"
+    "math/rand/v2"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// preflightReadTest reads up to n randomly chosen files under root in full, discarding the bytes, so a
+// failing disk or flaky mount is noticed before anything is uploaded. Like a backup run, it only considers
+// files selected by want in directories for which descend is true. Files that cannot be opened for lack of
+// permission are left to --on_unreadable. It returns the number of files read.
+func preflightReadTest(root string, descend func(path string) bool, want func(path string, info os.FileInfo) bool, n int) (int, error) {
+    // Reservoir sampling keeps memory bounded by n regardless of the tree size.
+    var sample []string
+    seen := 0
+    err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+        if err != nil {
+            return nil
+        }
+        if info.IsDir() {
+            if !descend(path) {
+                return filepath.SkipDir
+            }
+            return nil
+        }
+        if !want(path, info) {
+            return nil
+        }
+
+        seen++
+        if len(sample) < n {
+            sample = append(sample, path)
+        } else if i := rand.IntN(seen); i < n {
+            sample[i] = path
+        }
+        return nil
+    })
+    if err != nil {
+        return 0, fmt.Errorf("scan %s: %w", root, err)
+    }
+
+    var failures []string
+    for _, path := range sample {
+        if err := readAll(path); err != nil && !errors.Is(err, fs.ErrPermission) {
+            failures = append(failures, fmt.Sprintf("%s: %v", path, err))
+        }
+    }
+    if len(failures) > 0 {
+        return len(sample), fmt.Errorf("%d of %d sampled files could not be read:\n  %s", len(failures), len(sample), strings.Join(failures, "\n  "))
+    }
+
+    return len(sample), nil
+}
+
+// readAll reads a file to the end and discards its content.
+func readAll(path string) error {
+    f, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+
+    _, err = io.Copy(io.Discard, f)
+    return err
+}
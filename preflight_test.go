@@ -0,0 +1,55 @@
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func TestPreflightReadTestSkipsIgnoredPaths(t *testing.T) {
+    root := t.TempDir()
+    for _, dir := range []string{"skip", "sub"} {
+        if err := os.Mkdir(filepath.Join(root, dir), 0o755); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := os.WriteFile(filepath.Join(root, "map.smmx"), []byte("map"), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    if err := os.WriteFile(filepath.Join(root, ignoreFileName), []byte("skip/\nbad.smmx\n"), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    // Dangling links fail the read test unless the walk leaves them out.
+    for _, link := range []string{"bad.smmx", "skip/broken.smmx", "sub/broken.smmx"} {
+        if err := os.Symlink(filepath.Join(root, "missing"), filepath.Join(root, link)); err != nil {
+            t.Fatal(err)
+        }
+    }
+    ignore, err := loadIgnoreFile(root, "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    exts := parseExtensions(".smmx")
+    descend := func(path string) bool {
+        return path == root || path != filepath.Join(root, "sub") && !ignore.ignored(path, true)
+    }
+    want := func(path string, info os.FileInfo) bool {
+        return exts.match(info.Name()) && !ignore.ignored(path, false)
+    }
+
+    read, err := preflightReadTest(root, descend, want, 10)
+    if err != nil {
+        t.Fatalf("preflightReadTest: %v", err)
+    }
+    if read != 1 {
+        t.Errorf("read %d files, want 1", read)
+    }
+
+    stats, err := scanOnly(root, descend, want)
+    if err != nil {
+        t.Fatalf("scanOnly: %v", err)
+    }
+    if stats.files != 1 {
+        t.Errorf("scanOnly counted %d files, want 1", stats.files)
+    }
+}
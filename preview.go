@@ -0,0 +1,72 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "log"
+    "strings"
+    "time"
+
+    "github.com/volodymyroliinyk/go-joplin-file-backup/joplin"
+)
+
+// previewResourceID stands in for the ID of the resource a real run would upload.
+const previewResourceID = "NEW_RESOURCE_ID"
+
+// previewNotebookPrefix marks the placeholder ID of a notebook a --mirror_tree preview would create.
+const previewNotebookPrefix = "NEW_NOTEBOOK:"
+
+// previewFile reports what a backup run would do with a file that needs a new upload, without uploading
+// or writing anything. It prints the body of the note that would be written, or with --dry_run_diff a
+// unified diff against the current body of a note that would be updated, and the old resources the
+// update would delete.
+func (r *runner) previewFile(ctx context.Context, path, name string, createdAt time.Time, sum string, size int64, companions []companionFile, companionSum string, existing *joplin.Note, result fileResult) fileResult {
+    resourceID := previewResourceID
+    link := resourceLink(name, resourceID)
+    location := ""
+    if r.externalizeAbove > 0 && size > r.externalizeAbove {
+        location = r.externalLocation(externalName(path, sum))
+        resourceID, link = "", externalLink(name, location)
+    }
+
+    body, err := r.noteBody(path, result.Title, createdAt, sum, size, resourceID, companionLinks(companions)+link, location, companionSum)
+    if err != nil {
+        log.Printf("ERROR building note body for %s: %v", path, err)
+        result.fail(err)
+        return result
+    }
+
+    if existing == nil {
+        result.Status = "would-add"
+        fmt.Fprintf(r.out, "+++ new note %q\n%s", result.Title, indentLines(body, "+"))
+        return result
+    }
+
+    result.Status = "would-update"
+    result.NoteID = existing.ID
+    // Built first and written at once, so previews of files processed concurrently do not interleave.
+    var b strings.Builder
+    if r.showDiff {
+        fmt.Fprintf(&b, "--- note %q (%s)\n+++ would be written\n%s", existing.Title, existing.ID, unifiedDiff(existing.Body, body, 3))
+    } else {
+        fmt.Fprintf(&b, "+++ note %q (%s) would be written as\n%s", existing.Title, existing.ID, indentLines(body, "+"))
+    }
+    for _, id := range staleResources(resourceIDs(r.noteResources(ctx, *existing)), body) {
+        fmt.Fprintf(&b, "  would delete resource %s\n", id)
+    }
+    io.WriteString(r.out, b.String())
+    return result
+}
+
+// indentLines prefixes every line of s.
+func indentLines(s, prefix string) string {
+    lines := strings.SplitAfter(s, "\n")
+    var b strings.Builder
+    for _, line := range lines {
+        if line != "" {
+            b.WriteString(prefix + line)
+        }
+    }
+    return b.String()
+}
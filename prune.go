@@ -0,0 +1,96 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io/fs"
+    "log"
+    "os"
+    "path/filepath"
+    "sort"
+
+    "github.com/volodymyroliinyk/go-joplin-file-backup/joplin"
+)
+
+// prune deletes the notes of the notebook whose file has been removed from the directory, together with
+// the resources no remaining note links to. Only notes written by this tool are considered: their body
+// must record the file_path (or, for empty directory markers, the empty_directory) that no longer exists
+// on disk. Notes written by hand, notes of files merely left out by the filters and the index note are
+// never pruned. In preview mode the planned deletions are only printed.
+func (r *runner) prune(ctx context.Context, seen map[string]bool) (pruned int, failed int) {
+    var orphans []joplin.Note
+    kept := make(map[string]bool)
+    for title, note := range r.notesByTitle {
+        if !seen[title] && title != r.indexTitle && r.sourceRemoved(note) {
+            orphans = append(orphans, note)
+            continue
+        }
+        for _, rid := range extractResourceIDs(note.Body) {
+            kept[rid] = true
+        }
+    }
+    sort.Slice(orphans, func(i, j int) bool { return orphans[i].Title < orphans[j].Title })
+
+    for _, note := range orphans {
+        if ctx.Err() != nil || r.stopping.Load() {
+            break
+        }
+        if r.preview {
+            fmt.Fprintf(r.out, "  would prune %q (%s)\n", note.Title, note.ID)
+            continue
+        }
+
+        // Listed before the note is deleted, while Joplin still knows its attachments.
+        resources := resourceIDs(r.noteResources(ctx, note))
+        if err := r.client.DeleteNote(ctx, note.ID); err != nil {
+            log.Printf("ERROR pruning note %q: %v", note.Title, err)
+            failed++
+            continue
+        }
+        delete(r.notesByTitle, note.Title)
+        pruned++
+        fmt.Fprintf(r.out, "  pruned %q (%s)\n", note.Title, note.ID)
+
+        var orphaned []string
+        for _, rid := range resources {
+            if !kept[rid] {
+                orphaned = append(orphaned, rid)
+            }
+        }
+        for i, err := range r.deleteResources(ctx, orphaned) {
+            if err != nil {
+                log.Printf("WARNING: failed to delete resource %s of pruned note %q: %v", orphaned[i], note.Title, err)
+            } else {
+                r.stats.ResourcesDeleted++
+            }
+        }
+    }
+
+    if r.preview {
+        fmt.Fprintf(r.out, "Prune summary: would prune=%d\n", len(orphans))
+    } else {
+        fmt.Fprintf(r.out, "Prune summary: pruned=%d errors=%d\n", pruned, failed)
+    }
+    return pruned, failed
+}
+
+// sourceRemoved reports whether note carries this tool's metadata and the file or empty directory it
+// records is gone. A relative file_path was recorded against the working directory of the run that wrote
+// the note, which may not be this one's, so such a note is never pruned. A path that cannot be checked for
+// another reason counts as present.
+func (r *runner) sourceRemoved(note joplin.Note) bool {
+    meta := parseBodyMeta(note.Body)
+    path := meta["file_path"]
+    if path != "" && !filepath.IsAbs(path) {
+        return false
+    }
+    if path == "" && meta["empty_directory"] != "" {
+        path = filepath.Join(r.root, filepath.FromSlash(meta["empty_directory"]))
+    }
+    if path == "" {
+        return false
+    }
+    _, err := os.Lstat(path)
+    return errors.Is(err, fs.ErrNotExist)
+}
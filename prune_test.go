@@ -0,0 +1,54 @@
+package main
+
+import (
+    "context"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func TestPruneOnlyNotesOfRemovedFiles(t *testing.T) {
+    s := newStubJoplin(t)
+    root := t.TempDir()
+    present := filepath.Join(root, "filtered.smmx")
+    if err := os.WriteFile(present, []byte("map"), 0o644); err != nil {
+        t.Fatal(err)
+    }
+
+    goneRes := s.addResource("gone")
+    sharedRes := s.addResource("shared")
+    s.addNote("nb", "gone.smmx", metaBody("", "", filepath.Join(root, "gone.smmx"), "x", "3")+
+        "\n[gone.smmx](:/"+goneRes+")\n[shared.smmx](:/"+sharedRes+")\n")
+    s.addNote("nb", "filtered.smmx", metaBody("", "", present, "x", "3"))
+    // Recorded by a run with a relative --directory, elsewhere; it cannot be checked from here.
+    s.addNote("nb", "relative.smmx", metaBody("", "", filepath.Join("maps", "relative.smmx"), "x", "3"))
+    s.addNote("nb", "Shopping list", "milk\n\n[shared.smmx](:/"+sharedRes+")\n")
+
+    r := newTestRunner(s, root)
+    ctx := context.Background()
+    notes, err := r.client.NotesByTitle(ctx, "nb")
+    if err != nil {
+        t.Fatal(err)
+    }
+    r.notesByTitle = notes
+
+    // Nothing was seen, as in a run whose filters leave out every file.
+    pruned, failed := r.prune(ctx, map[string]bool{})
+    if pruned != 1 || failed != 0 {
+        t.Fatalf("prune = %d pruned, %d failed, want 1, 0", pruned, failed)
+    }
+    if got := s.notesTitled("gone.smmx"); len(got) != 0 {
+        t.Errorf("note of the removed file was kept: %+v", got)
+    }
+    for _, title := range []string{"filtered.smmx", "relative.smmx", "Shopping list"} {
+        if got := s.notesTitled(title); len(got) != 1 {
+            t.Errorf("note %q: got %d notes, want it kept", title, len(got))
+        }
+    }
+    if s.hasResource(goneRes) {
+        t.Errorf("resource %s of the pruned note was kept", goneRes)
+    }
+    if !s.hasResource(sharedRes) {
+        t.Errorf("resource %s still linked by another note was deleted", sharedRes)
+    }
+}
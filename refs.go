@@ -0,0 +1,131 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "sort"
+
+    "github.com/volodymyroliinyk/go-joplin-file-backup/joplin"
+)
+
+// resourceRefsReport prints, without modifying anything, the resources referenced by more than one note of the
+// notebook and the resources no note references at all. References are collected per note of the notebook;
+// a resource unknown to the notebook is only reported as unreferenced after Joplin confirms that no note in
+// any other notebook links to it either. It returns the number of unreferenced and shared resources.
+func (r *runner) resourceRefsReport(ctx context.Context) (int, int, error) {
+    refs, err := r.notebookResourceRefs(ctx)
+    if err != nil {
+        return 0, 0, err
+    }
+
+    var shared []string
+    for id, titles := range refs {
+        if len(titles) > 1 {
+            shared = append(shared, id)
+        }
+    }
+    sort.Strings(shared)
+
+    fmt.Fprintf(r.out, "Resources referenced by more than one note: %d\n", len(shared))
+    for _, id := range shared {
+        titles := refs[id]
+        sort.Strings(titles)
+        fmt.Fprintf(r.out, "  %s\n", id)
+        for _, title := range titles {
+            fmt.Fprintf(r.out, "    %s\n", title)
+        }
+    }
+
+    orphans, err := r.orphanResources(ctx, refs)
+    if err != nil {
+        return 0, len(shared), err
+    }
+
+    fmt.Fprintf(r.out, "Resources referenced by no note: %d\n", len(orphans))
+    for _, res := range orphans {
+        fmt.Fprintf(r.out, "  %s %s (%d bytes)\n", res.ID, res.Title, res.Size)
+    }
+
+    return len(orphans), len(shared), nil
+}
+
+// notebookResourceRefs maps the ID of every resource referenced by a note of the notebook to the titles of
+// the notes referencing it.
+func (r *runner) notebookResourceRefs(ctx context.Context) (map[string][]string, error) {
+    notes, err := r.client.NotesByTitleMulti(ctx, r.notebookId)
+    if err != nil {
+        return nil, err
+    }
+
+    refs := make(map[string][]string)
+    for _, list := range notes {
+        for _, note := range list {
+            for _, id := range resourceIDs(r.noteResources(ctx, note)) {
+                refs[id] = append(refs[id], note.Title)
+            }
+        }
+    }
+    return refs, nil
+}
+
+// orphanResources returns, sorted by ID, the resources of the profile that are neither in refs nor
+// referenced by any note of another notebook.
+func (r *runner) orphanResources(ctx context.Context, refs map[string][]string) ([]joplin.Resource, error) {
+    all, err := r.client.AllResources(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    var orphans []joplin.Resource
+    for _, res := range all {
+        if _, ok := refs[res.ID]; ok {
+            continue
+        }
+        elsewhere, err := r.client.ResourceNotes(ctx, res.ID)
+        if err != nil {
+            return nil, err
+        }
+        if len(elsewhere) == 0 {
+            orphans = append(orphans, res)
+        }
+    }
+    sort.Slice(orphans, func(i, j int) bool { return orphans[i].ID < orphans[j].ID })
+    return orphans, nil
+}
+
+// cleanupOrphans deletes the resources no note references, as listed by --resource_refs_report. With dryRun
+// nothing is deleted; the orphans are only printed.
+func (r *runner) cleanupOrphans(ctx context.Context, dryRun bool) (deleted int, failed int, err error) {
+    refs, err := r.notebookResourceRefs(ctx)
+    if err != nil {
+        return 0, 0, err
+    }
+    orphans, err := r.orphanResources(ctx, refs)
+    if err != nil {
+        return 0, 0, err
+    }
+
+    ids := make([]string, len(orphans))
+    for i, res := range orphans {
+        ids[i] = res.ID
+        if dryRun {
+            fmt.Fprintf(r.out, "  would delete resource %s %s (%d bytes)\n", res.ID, res.Title, res.Size)
+        }
+    }
+    if !dryRun {
+        for i, err := range r.deleteResources(ctx, ids) {
+            res := orphans[i]
+            if err != nil {
+                log.Printf("ERROR deleting orphaned resource %s: %v", res.ID, err)
+                failed++
+                continue
+            }
+            deleted++
+            fmt.Fprintf(r.out, "  deleted resource %s %s (%d bytes)\n", res.ID, res.Title, res.Size)
+        }
+    }
+
+    fmt.Fprintf(r.out, "Orphan cleanup summary: orphaned=%d deleted=%d errors=%d\n", len(orphans), deleted, failed)
+    return deleted, failed, nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "os"
+    "syscall"
+    "time"
+)
+
+// runStateSaveInterval throttles state file writes during the walk. Losing the last interval's progress
+// in a crash only means those files are processed again, which is harmless.
+const runStateSaveInterval = time.Second
+
+// runState is the content of --state_file.
+type runState struct {
+    // RunStarted and RunCompleted bracket the last backup run; a start without a completion means the run
+    // crashed or was interrupted.
+    RunStarted   time.Time  `json:"run_started"`
+    RunCompleted *time.Time `json:"run_completed,omitempty"`
+
+    // Done lists the files the unfinished run has already backed up; it is cleared on completion.
+    Done []string `json:"done,omitempty"`
+
+    // Files records, by path, each file as it was last backed up.
+    Files map[string]fileRecord `json:"files,omitempty"`
+}
+
+// fileRecord is the state of a file when it was last backed up.
+type fileRecord struct {
+    Size       int64     `json:"size"`
+    ModTime    time.Time `json:"mtime"`
+    SHA256     string    `json:"sha256"`
+    NoteID     string    `json:"note_id"`
+    ResourceID string    `json:"resource_id,omitempty"`
+}
+
+// loadRunState reads the state file. A missing file yields an empty state; a corrupt one is logged
+// and treated as missing, so the run falls back to processing every file.
+func loadRunState(path string) *runState {
+    st := &runState{}
+
+    data, err := os.ReadFile(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return st
+    }
+    if err != nil {
+        log.Printf("WARNING: cannot read state file %s, ignoring it: %v", path, err)
+        return st
+    }
+    if err := json.Unmarshal(data, st); err != nil {
+        log.Printf("WARNING: state file %s is corrupt, ignoring it: %v", path, err)
+        return &runState{}
+    }
+    return st
+}
+
+// startRun records the start of a run in the state file. If the previous run never completed, the files it
+// finished are remembered in r.resumeDone and skipped by this run.
+func (r *runner) startRun() error {
+    if err := r.lockRunState(); err != nil {
+        return err
+    }
+    st := loadRunState(r.stateFile)
+
+    if !st.RunStarted.IsZero() && st.RunCompleted == nil {
+        r.resumeDone = make(map[string]bool, len(st.Done))
+        for _, path := range st.Done {
+            r.resumeDone[path] = true
+        }
+        log.Printf("previous run started at %s did not finish; resuming, %d files already done are skipped", st.RunStarted.Format(time.RFC3339), len(st.Done))
+    } else {
+        st.Done = nil
+    }
+
+    // A snapshot, so concurrent workers can read it while fileDone updates st.Files.
+    r.prevFiles = make(map[string]fileRecord, len(st.Files))
+    for path, rec := range st.Files {
+        r.prevFiles[path] = rec
+    }
+    if st.Files == nil {
+        st.Files = make(map[string]fileRecord)
+    }
+
+    st.RunStarted = time.Now().UTC()
+    st.RunCompleted = nil
+    r.state = st
+    return r.saveRunState()
+}
+
+// lockRunState takes an exclusive lock on the state file's ".lock" companion for the rest of the process,
+// so two runs sharing a state file (e.g. overlapping cron jobs) cannot overwrite each other's records.
+// The lock is released by the kernel when the process exits, even after a crash.
+func (r *runner) lockRunState() error {
+    f, err := os.OpenFile(r.stateFile+".lock", os.O_RDWR|os.O_CREATE, 0o600)
+    if err != nil {
+        return fmt.Errorf("open state lock: %w", err)
+    }
+    if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+        f.Close()
+        if errors.Is(err, syscall.EWOULDBLOCK) {
+            return fmt.Errorf("state file %s is in use by another run", r.stateFile)
+        }
+        return fmt.Errorf("lock state file: %w", err)
+    }
+    r.stateLock = f
+    return nil
+}
+
+// trustedRecord returns the recorded state of a file if --trust_mtime applies and its size and mtime
+// still match, in which case the file can be assumed unchanged. It never applies with --repair, which
+// must look at every note, or with --sidecar_suffix or --companion_extensions, whose sidecar and companion
+// edits do not touch the file.
+func (r *runner) trustedRecord(path string, info os.FileInfo) (fileRecord, bool) {
+    if !r.trustMtime || r.repair || r.sidecarSuffix != "" || len(r.companionExts) > 0 {
+        return fileRecord{}, false
+    }
+    rec, ok := r.prevFiles[path]
+    if !ok || rec.NoteID == "" || rec.Size != info.Size() || !rec.ModTime.Equal(info.ModTime()) {
+        return fileRecord{}, false
+    }
+    return rec, true
+}
+
+// fileDone records a backed up file in the state file, at most once per runStateSaveInterval.
+func (r *runner) fileDone(result fileResult) {
+    if r.state == nil {
+        return
+    }
+    path := result.Path
+    r.state.Done = append(r.state.Done, path)
+    switch result.Status {
+    case "added", "updated", "unchanged":
+        if !result.modTime.IsZero() && result.NoteID != "" {
+            rec := fileRecord{
+                Size:       result.Size,
+                ModTime:    result.modTime,
+                SHA256:     result.SHA256,
+                NoteID:     result.NoteID,
+                ResourceID: result.ResourceID,
+            }
+            if prev := r.state.Files[path]; rec.ResourceID == "" && prev.NoteID == rec.NoteID {
+                rec.ResourceID = prev.ResourceID
+            }
+            r.state.Files[path] = rec
+        }
+    }
+    if time.Since(r.stateSavedAt) < runStateSaveInterval {
+        r.stateDirty = true
+        return
+    }
+    if err := r.saveRunState(); err != nil {
+        log.Printf("WARNING: %v", err)
+    }
+}
+
+// flushRunState writes progress not yet saved by fileDone.
+func (r *runner) flushRunState() {
+    if r.state == nil || !r.stateDirty {
+        return
+    }
+    if err := r.saveRunState(); err != nil {
+        log.Printf("WARNING: %v", err)
+    }
+}
+
+// completeRun marks the run as finished, so the next run starts from scratch.
+func (r *runner) completeRun() {
+    if r.state == nil {
+        return
+    }
+    now := time.Now().UTC()
+    r.state.RunCompleted = &now
+    r.state.Done = nil
+    if err := r.saveRunState(); err != nil {
+        log.Printf("WARNING: %v", err)
+    }
+}
+
+func (r *runner) saveRunState() error {
+    data, err := json.MarshalIndent(r.state, "", "  ")
+    if err != nil {
+        return fmt.Errorf("encode state file: %w", err)
+    }
+    if err := writeStateFile(r.stateFile, append(data, '\n'), r.fsyncState); err != nil {
+        return fmt.Errorf("write state file %s: %w", r.stateFile, err)
+    }
+    r.stateSavedAt = time.Now()
+    r.stateDirty = false
+    return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+)
+
+// safeModePreset lists the flag values --safe_mode implies, in the order they are applied.
+// Deleting notes (--dedupe) still needs an explicit --yes, and /ping-independent token
+// validation always aborts on an auth error, so neither needs an entry here.
+var safeModePreset = []struct{ name, value string }{
+    {"prune", "false"},
+    {"on_conflict", "skip"},
+    {"require_notebook", "true"},
+    {"verify_size", "true"},
+}
+
+// applySafeMode sets every preset flag the user did not pass explicitly and returns the
+// applied settings as name=value pairs.
+func applySafeMode() ([]string, error) {
+    explicit := make(map[string]bool)
+    flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+    var applied []string
+    for _, p := range safeModePreset {
+        if explicit[p.name] {
+            continue
+        }
+        if err := flag.Set(p.name, p.value); err != nil {
+            return nil, fmt.Errorf("set --%s=%s: %w", p.name, p.value, err)
+        }
+        applied = append(applied, p.name+"="+p.value)
+    }
+    return applied, nil
+}
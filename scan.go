@@ -0,0 +1,121 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "io/fs"
+    "log"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "time"
+)
+
+// scannedFile is one file noted by scanOnly.
+type scannedFile struct {
+    path    string
+    size    int64
+    modTime time.Time
+}
+
+// extStats counts the files of one extension.
+type extStats struct {
+    files int
+    bytes int64
+}
+
+// scanStats summarizes the files a backup run would process (--scan_only).
+type scanStats struct {
+    files      int
+    bytes      int64
+    byExt      map[string]*extStats
+    oldest     scannedFile
+    newest     scannedFile
+    largest    scannedFile
+    unreadable int
+}
+
+// scanOnly walks root like a backup run, entering directories for which descend is true and selecting
+// files with want, and gathers statistics about them without contacting Joplin. Unreadable paths are
+// counted and skipped.
+func scanOnly(root string, descend func(path string) bool, want func(path string, info os.FileInfo) bool) (scanStats, error) {
+    stats := scanStats{byExt: make(map[string]*extStats)}
+
+    err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+        if errors.Is(err, fs.ErrNotExist) {
+            return nil
+        }
+        if err != nil {
+            log.Printf("WARNING: cannot read %s: %v", path, err)
+            stats.unreadable++
+            return nil
+        }
+        if info.IsDir() {
+            if !descend(path) {
+                return filepath.SkipDir
+            }
+            return nil
+        }
+        if !want(path, info) {
+            return nil
+        }
+
+        f := scannedFile{path: path, size: info.Size(), modTime: info.ModTime()}
+        if stats.files == 0 || f.modTime.Before(stats.oldest.modTime) {
+            stats.oldest = f
+        }
+        if stats.files == 0 || f.modTime.After(stats.newest.modTime) {
+            stats.newest = f
+        }
+        if stats.files == 0 || f.size > stats.largest.size {
+            stats.largest = f
+        }
+        stats.files++
+        stats.bytes += f.size
+
+        ext := strings.ToLower(filepath.Ext(info.Name()))
+        if ext == "" {
+            ext = "(none)"
+        }
+        e := stats.byExt[ext]
+        if e == nil {
+            e = &extStats{}
+            stats.byExt[ext] = e
+        }
+        e.files++
+        e.bytes += f.size
+        return nil
+    })
+    if err != nil {
+        return stats, fmt.Errorf("scan %s: %w", root, err)
+    }
+    return stats, nil
+}
+
+// print writes the scan statistics, extensions sorted by file count.
+func (s scanStats) print(w io.Writer) {
+    fmt.Fprintf(w, "Scan summary: files=%d bytes=%d (%s) unreadable=%d\n", s.files, s.bytes, humanSize(s.bytes), s.unreadable)
+    if s.files == 0 {
+        return
+    }
+
+    exts := make([]string, 0, len(s.byExt))
+    for ext := range s.byExt {
+        exts = append(exts, ext)
+    }
+    sort.Slice(exts, func(i, j int) bool {
+        if s.byExt[exts[i]].files != s.byExt[exts[j]].files {
+            return s.byExt[exts[i]].files > s.byExt[exts[j]].files
+        }
+        return exts[i] < exts[j]
+    })
+    for _, ext := range exts {
+        fmt.Fprintf(w, "  %s: files=%d bytes=%d (%s)\n", ext, s.byExt[ext].files, s.byExt[ext].bytes, humanSize(s.byExt[ext].bytes))
+    }
+
+    fmt.Fprintf(w, "  oldest:  %s (modified %s)\n", s.oldest.path, s.oldest.modTime.Format(time.RFC3339))
+    fmt.Fprintf(w, "  newest:  %s (modified %s)\n", s.newest.path, s.newest.modTime.Format(time.RFC3339))
+    fmt.Fprintf(w, "  largest: %s (%s)\n", s.largest.path, humanSize(s.largest.size))
+}
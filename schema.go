@@ -0,0 +1,58 @@
+package main
+
+import (
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io"
+    "strconv"
+    "time"
+)
+
+// schemaProperty describes one option in the JSON Schema printed by --print_config_schema.
+type schemaProperty struct {
+    Type        string `json:"type"`
+    Format      string `json:"format,omitempty"`
+    Default     any    `json:"default"`
+    Description string `json:"description"`
+}
+
+// printConfigSchema writes a JSON Schema describing every command-line option: its JSON type, default and
+// help text. It is generated from the registered flags, so it cannot drift from what the tool accepts.
+func printConfigSchema(w io.Writer) error {
+    props := make(map[string]schemaProperty)
+    flag.VisitAll(func(f *flag.Flag) {
+        p := schemaProperty{Type: "string", Default: f.DefValue, Description: f.Usage}
+        if getter, ok := f.Value.(flag.Getter); ok {
+            switch getter.Get().(type) {
+            case bool:
+                p.Type = "boolean"
+                p.Default, _ = strconv.ParseBool(f.DefValue)
+            case int, int64, uint, uint64:
+                p.Type = "integer"
+                p.Default, _ = strconv.ParseInt(f.DefValue, 10, 64)
+            case float64:
+                p.Type = "number"
+                p.Default, _ = strconv.ParseFloat(f.DefValue, 64)
+            case time.Duration:
+                // Go duration syntax, e.g. "1m30s".
+                p.Format = "duration"
+            }
+        }
+        props[f.Name] = p
+    })
+
+    schema := map[string]any{
+        "$schema":              "https://json-schema.org/draft/2020-12/schema",
+        "title":                "go-joplin-file-backup options",
+        "type":                 "object",
+        "additionalProperties": false,
+        "properties":           props,
+    }
+    data, err := json.MarshalIndent(schema, "", "  ")
+    if err != nil {
+        return fmt.Errorf("encode schema: %w", err)
+    }
+    _, err = w.Write(append(data, '\n'))
+    return err
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+)
+
+// writeStateFile replaces path with data through a temp file in the same directory and a rename,
+// so readers never see a half-written file. With durable set, the temp file is fsync'd before the
+// rename and the directory is fsync'd after it, so the new content survives a power loss.
+func writeStateFile(path string, data []byte, durable bool) error {
+    dir := filepath.Dir(path)
+
+    tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+    if err != nil {
+        return fmt.Errorf("create temp state file: %w", err)
+    }
+    tmpName := tmp.Name()
+    // Cleanup on failure; after a successful rename the temp name no longer exists.
+    defer os.Remove(tmpName)
+
+    if _, err := tmp.Write(data); err != nil {
+        tmp.Close()
+        return fmt.Errorf("write temp state file: %w", err)
+    }
+
+    if durable {
+        if err := tmp.Sync(); err != nil {
+            tmp.Close()
+            return fmt.Errorf("fsync temp state file: %w", err)
+        }
+    }
+
+    if err := tmp.Close(); err != nil {
+        return fmt.Errorf("close temp state file: %w", err)
+    }
+
+    if err := os.Rename(tmpName, path); err != nil {
+        return fmt.Errorf("rename state file: %w", err)
+    }
+
+    if durable {
+        if err := syncDir(dir); err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+// syncDir fsyncs a directory so a rename inside it is persisted.
+func syncDir(dir string) error {
+    d, err := os.Open(dir)
+    if err != nil {
+        return fmt.Errorf("open state dir: %w", err)
+    }
+    defer d.Close()
+
+    if err := d.Sync(); err != nil {
+        return fmt.Errorf("fsync state dir: %w", err)
+    }
+    return nil
+}
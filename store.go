@@ -0,0 +1,68 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "log"
+
+    "github.com/volodymyroliinyk/go-joplin-file-backup/joplin"
+)
+
+// verifySizeAttempts is how many times --verify_size uploads a file before giving up.
+const verifySizeAttempts = 3
+
+// storeResource uploads a file as a resource and, if configured, checks its stored size: with --two_phase
+// it waits for the size to match, with --verify it checks once; either way a resource that does not match
+// is rolled back and the file fails. --verify_size has already re-uploaded on mismatch.
+func (r *runner) storeResource(ctx context.Context, path, title string, size int64) (*joplin.Resource, error) {
+    res, err := r.uploadResource(ctx, path, title, size)
+    if err != nil {
+        return nil, err
+    }
+
+    if r.twoPhase {
+        // Phase one: the note is only touched once Joplin holds the complete resource.
+        if err := r.confirmResource(ctx, res.ID, size); err != nil {
+            r.rollbackResource(ctx, res.ID, path)
+            return nil, err
+        }
+    } else if r.verify && !r.verifySize {
+        stored, err := r.client.Resource(ctx, res.ID, "id", "title", "size")
+        if err == nil && stored.Size != size {
+            err = fmt.Errorf("resource %s has size %d in Joplin, local file has %d", res.ID, stored.Size, size)
+        }
+        if err != nil {
+            log.Printf("ERROR verifying upload of %s: %v", path, err)
+            r.rollbackResource(ctx, res.ID, path)
+            return nil, fmt.Errorf("verify upload: %w", err)
+        }
+    }
+
+    return res, nil
+}
+
+// uploadResource uploads a file as a resource. With --verify_size, the stored size is compared with the
+// local size after each upload; a truncated resource is deleted and the upload repeated, up to
+// verifySizeAttempts times in total.
+func (r *runner) uploadResource(ctx context.Context, path, title string, size int64) (*joplin.Resource, error) {
+    for attempt := 1; ; attempt++ {
+        res, err := r.client.UploadResource(ctx, path, title)
+        if err != nil || !r.verifySize {
+            return res, err
+        }
+
+        stored, err := r.client.Resource(ctx, res.ID, "id", "size")
+        if err == nil && stored.Size == size {
+            return res, nil
+        }
+        if err == nil {
+            err = fmt.Errorf("resource %s has size %d in Joplin, local file has %d", res.ID, stored.Size, size)
+        }
+
+        r.rollbackResource(ctx, res.ID, path)
+        if attempt == verifySizeAttempts {
+            return nil, fmt.Errorf("size check failed after %d uploads: %w", attempt, err)
+        }
+        log.Printf("WARNING: size check failed for %s, uploading again: %v", path, err)
+    }
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+    "context"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func TestStoreResourceVerify(t *testing.T) {
+    s := newStubJoplin(t)
+    root := t.TempDir()
+    path := filepath.Join(root, "map.smmx")
+    data := []byte("mind map")
+    if err := os.WriteFile(path, data, 0o644); err != nil {
+        t.Fatal(err)
+    }
+
+    r := newTestRunner(s, root)
+    r.verify = true
+    res, err := r.storeResource(context.Background(), path, "map.smmx", int64(len(data)))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got := string(s.resources[res.ID]); got != string(data) {
+        t.Errorf("stored %q, want %q", got, data)
+    }
+
+    // A local size that does not match the upload fails the file and rolls the resource back.
+    if _, err := r.storeResource(context.Background(), path, "map.smmx", int64(len(data))+1); err == nil {
+        t.Error("size mismatch was not reported")
+    }
+    if len(s.resources) != 1 {
+        t.Errorf("%d resources left, want only the first upload", len(s.resources))
+    }
+}
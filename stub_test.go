@@ -0,0 +1,221 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/volodymyroliinyk/go-joplin-file-backup/joplin"
+)
+
+// stubJoplin is an in-memory stand-in for the Joplin Data API, covering the endpoints a backup run uses.
+type stubJoplin struct {
+    *httptest.Server
+
+    mu        sync.Mutex
+    nextID    int
+    notes     map[string]stubNote
+    resources map[string][]byte
+    // createDelay widens the window between a note lookup and its creation, to expose races.
+    createDelay time.Duration
+}
+
+type stubNote struct {
+    ID       string `json:"id"`
+    ParentID string `json:"parent_id"`
+    Title    string `json:"title"`
+    Body     string `json:"body"`
+    // UpdatedTime is only set by tests; the stub does not maintain it.
+    UpdatedTime int64 `json:"updated_time"`
+}
+
+func newStubJoplin(t *testing.T) *stubJoplin {
+    t.Helper()
+    s := &stubJoplin{notes: map[string]stubNote{}, resources: map[string][]byte{}}
+    s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+    t.Cleanup(s.Close)
+    return s
+}
+
+func (s *stubJoplin) client() *joplin.Client {
+    return joplin.NewClient(s.URL, "token")
+}
+
+// id returns a new 32-hex item ID.
+func (s *stubJoplin) id() string {
+    s.nextID++
+    return fmt.Sprintf("%032x", s.nextID)
+}
+
+// addNote stores a note directly, as if it had been created in Joplin.
+func (s *stubJoplin) addNote(parentID, title, body string) string {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    id := s.id()
+    s.notes[id] = stubNote{ID: id, ParentID: parentID, Title: title, Body: body}
+    return id
+}
+
+// addResource stores a resource directly and returns its ID.
+func (s *stubJoplin) addResource(data string) string {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    id := s.id()
+    s.resources[id] = []byte(data)
+    return id
+}
+
+// hasResource reports whether the resource with the given ID exists.
+func (s *stubJoplin) hasResource(id string) bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    _, ok := s.resources[id]
+    return ok
+}
+
+// notesTitled returns the notes with the given title.
+func (s *stubJoplin) notesTitled(title string) []stubNote {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    var notes []stubNote
+    for _, n := range s.notes {
+        if n.Title == title {
+            notes = append(notes, n)
+        }
+    }
+    return notes
+}
+
+func (s *stubJoplin) serve(w http.ResponseWriter, req *http.Request) {
+    parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+    list := func(items any) {
+        json.NewEncoder(w).Encode(map[string]any{"items": items, "has_more": false})
+    }
+
+    switch {
+    case req.Method == http.MethodGet && len(parts) == 3 && parts[0] == "folders" && parts[2] == "notes":
+        s.mu.Lock()
+        notes := []stubNote{}
+        for _, n := range s.notes {
+            if n.ParentID == parts[1] {
+                notes = append(notes, n)
+            }
+        }
+        s.mu.Unlock()
+        list(notes)
+
+    case req.Method == http.MethodPost && len(parts) == 1 && parts[0] == "notes":
+        var n stubNote
+        json.NewDecoder(req.Body).Decode(&n)
+        time.Sleep(s.createDelay)
+        s.mu.Lock()
+        n.ID = s.id()
+        s.notes[n.ID] = n
+        s.mu.Unlock()
+        json.NewEncoder(w).Encode(n)
+
+    case len(parts) == 2 && parts[0] == "notes":
+        s.mu.Lock()
+        defer s.mu.Unlock()
+        n, ok := s.notes[parts[1]]
+        if !ok {
+            http.NotFound(w, req)
+            return
+        }
+        switch req.Method {
+        case http.MethodGet:
+            json.NewEncoder(w).Encode(n)
+        case http.MethodPut:
+            json.NewDecoder(req.Body).Decode(&n)
+            s.notes[n.ID] = n
+            json.NewEncoder(w).Encode(n)
+        case http.MethodDelete:
+            delete(s.notes, n.ID)
+        }
+
+    case req.Method == http.MethodGet && len(parts) == 3 && parts[0] == "notes" && parts[2] == "resources":
+        s.mu.Lock()
+        n := s.notes[parts[1]]
+        s.mu.Unlock()
+        resources := []joplin.Resource{}
+        for _, id := range extractResourceIDs(n.Body) {
+            resources = append(resources, joplin.Resource{ID: id})
+        }
+        list(resources)
+
+    case req.Method == http.MethodPost && len(parts) == 1 && parts[0] == "resources":
+        f, _, err := req.FormFile("data")
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        data, _ := io.ReadAll(f)
+        var props struct{ Title string }
+        json.Unmarshal([]byte(req.FormValue("props")), &props)
+        s.mu.Lock()
+        id := s.id()
+        s.resources[id] = data
+        s.mu.Unlock()
+        json.NewEncoder(w).Encode(joplin.Resource{ID: id, Title: props.Title, Size: int64(len(data))})
+
+    case req.Method == http.MethodGet && len(parts) == 1 && parts[0] == "resources":
+        s.mu.Lock()
+        resources := []joplin.Resource{}
+        for id, data := range s.resources {
+            resources = append(resources, joplin.Resource{ID: id, Size: int64(len(data))})
+        }
+        s.mu.Unlock()
+        list(resources)
+
+    case req.Method == http.MethodGet && len(parts) == 3 && parts[0] == "resources" && parts[2] == "notes":
+        s.mu.Lock()
+        notes := []stubNote{}
+        for _, n := range s.notes {
+            for _, id := range extractResourceIDs(n.Body) {
+                if id == parts[1] {
+                    notes = append(notes, n)
+                    break
+                }
+            }
+        }
+        s.mu.Unlock()
+        list(notes)
+
+    case len(parts) == 2 && parts[0] == "resources":
+        s.mu.Lock()
+        defer s.mu.Unlock()
+        data, ok := s.resources[parts[1]]
+        if !ok {
+            http.NotFound(w, req)
+            return
+        }
+        switch req.Method {
+        case http.MethodGet:
+            json.NewEncoder(w).Encode(joplin.Resource{ID: parts[1], Size: int64(len(data))})
+        case http.MethodDelete:
+            delete(s.resources, parts[1])
+        }
+
+    default:
+        http.NotFound(w, req)
+    }
+}
+
+// newTestRunner returns a runner backing up root into notebook "nb" of s, with the defaults of a plain run.
+func newTestRunner(s *stubJoplin, root string) *runner {
+    return &runner{
+        client:        s.client(),
+        root:          root,
+        notebookId:    "nb",
+        notesByTitle:  map[string]joplin.Note{},
+        out:           io.Discard,
+        cleanupSem:    make(chan struct{}, 1),
+        onlyIfChanged: true,
+    }
+}
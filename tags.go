@@ -0,0 +1,84 @@
+package main
+
+import (
+    "context"
+    "log"
+    "path/filepath"
+    "strings"
+)
+
+// tagID returns the ID of the tag with the given title, creating the tag if it does not exist.
+// All tags are listed once per run; later lookups are served from the cache.
+func (r *runner) tagID(ctx context.Context, title string) (string, error) {
+    // Joplin stores tag titles in lower case.
+    title = strings.ToLower(title)
+
+    r.cacheMu.Lock()
+    defer r.cacheMu.Unlock()
+
+    if r.tagIDs == nil {
+        tags, err := r.client.Tags(ctx)
+        if err != nil {
+            return "", err
+        }
+        r.tagIDs = make(map[string]string, len(tags))
+        for _, t := range tags {
+            r.tagIDs[strings.ToLower(t.Title)] = t.ID
+        }
+    }
+
+    if id, ok := r.tagIDs[title]; ok {
+        return id, nil
+    }
+
+    tag, err := r.client.CreateTag(ctx, title)
+    if err != nil {
+        return "", err
+    }
+    r.tagIDs[title] = tag.ID
+    return tag.ID, nil
+}
+
+// tagNote applies the tags configured for the run (--tag, --auto_tag_by_extension) to a backed up note.
+// It only adds the tags the note does not have yet and never removes any, so tags applied by the
+// user in Joplin survive every update. Tagging failures are logged but never fail the file.
+func (r *runner) tagNote(ctx context.Context, path, noteID string) {
+    var titles []string
+    if r.tag != "" {
+        titles = append(titles, r.tag)
+    }
+    if r.autoTagByExtension {
+        if ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), "."); ext != "" {
+            titles = append(titles, ext)
+        }
+    }
+    if len(titles) == 0 {
+        return
+    }
+
+    current, err := r.client.NoteTags(ctx, noteID)
+    if err != nil {
+        // Tagging is idempotent, so an unknown tag list only costs redundant requests.
+        log.Printf("WARNING: failed to list the tags of the note for %s: %v", path, err)
+    }
+    has := make(map[string]bool, len(current))
+    for _, t := range current {
+        has[t.ID] = true
+    }
+
+    for _, title := range titles {
+        id, err := r.tagID(ctx, title)
+        if err != nil {
+            log.Printf("WARNING: failed to resolve tag %q for %s: %v", title, path, err)
+            continue
+        }
+        if has[id] {
+            continue
+        }
+        if err := r.client.TagNote(ctx, id, noteID); err != nil {
+            log.Printf("WARNING: failed to tag note for %s with %q: %v", path, title, err)
+            continue
+        }
+        has[id] = true
+    }
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// loadTitleMap reads a --title_map file mapping a file (its path relative to --directory, with "/" separators,
+// or its base name) to a note title. Files ending in .csv hold "file,title" rows; anything else is read as a
+// JSON object. Empty keys or titles and titles used by more than one entry are rejected.
+func loadTitleMap(path string) (map[string]string, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+
+    m := make(map[string]string)
+    if strings.EqualFold(filepath.Ext(path), ".csv") {
+        rows, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+        if err != nil {
+            return nil, fmt.Errorf("parse CSV: %w", err)
+        }
+        for i, row := range rows {
+            if len(row) != 2 {
+                return nil, fmt.Errorf("line %d: want 2 columns (file,title), got %d", i+1, len(row))
+            }
+            if _, dup := m[row[0]]; dup {
+                return nil, fmt.Errorf("line %d: %q is mapped more than once", i+1, row[0])
+            }
+            m[row[0]] = row[1]
+        }
+    } else if err := json.Unmarshal(data, &m); err != nil {
+        return nil, fmt.Errorf("parse JSON: %w", err)
+    }
+
+    files := make(map[string]string, len(m))
+    for file, title := range m {
+        if strings.TrimSpace(file) == "" || strings.TrimSpace(title) == "" {
+            return nil, fmt.Errorf("entry %q → %q: file and title must not be empty", file, title)
+        }
+        if other, ok := files[title]; ok {
+            return nil, fmt.Errorf("title %q is mapped from both %q and %q", title, other, file)
+        }
+        files[title] = file
+    }
+
+    return m, nil
+}
+
+// noteTitle returns the note title for a file: its --title_map entry by relative path, then by base name,
+// falling back to the (sanitized) file name.
+func (r *runner) noteTitle(path, name string) string {
+    if len(r.titleMap) == 0 {
+        return name
+    }
+    if rel, err := filepath.Rel(r.root, path); err == nil {
+        if title, ok := r.titleMap[filepath.ToSlash(rel)]; ok {
+            return title
+        }
+    }
+    if title, ok := r.titleMap[filepath.Base(path)]; ok {
+        return title
+    }
+    return name
+}
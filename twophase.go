@@ -0,0 +1,50 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "time"
+)
+
+// rollbackTimeout bounds the deletion of an unconfirmed resource, which runs even when the file's own
+// context has been cancelled or has timed out.
+const rollbackTimeout = 30 * time.Second
+
+// confirmResource polls Joplin until the uploaded resource reports the expected size, waiting at most
+// r.twoPhaseTimeout. It returns an error if the size never matches.
+func (r *runner) confirmResource(ctx context.Context, id string, size int64) error {
+    ctx, cancel := context.WithTimeout(ctx, r.twoPhaseTimeout)
+    defer cancel()
+
+    delay := 200 * time.Millisecond
+    for {
+        stored, err := r.client.Resource(ctx, id, "id", "size")
+        if err == nil && stored.Size == size {
+            return nil
+        }
+
+        select {
+        case <-ctx.Done():
+            if err != nil {
+                return fmt.Errorf("resource %s not confirmed: %w", id, err)
+            }
+            return fmt.Errorf("resource %s not confirmed: stored size %d, local file has %d", id, stored.Size, size)
+        case <-time.After(delay):
+        }
+        delay = min(2*delay, 2*time.Second)
+    }
+}
+
+// rollbackResource deletes a resource uploaded for a file whose note could not be written, so no
+// unreferenced resource is left behind.
+func (r *runner) rollbackResource(ctx context.Context, id, path string) {
+    ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+    defer cancel()
+
+    if err := r.client.DeleteResource(ctx, id); err != nil {
+        log.Printf("WARNING: rollback failed, resource %s for %s is left unreferenced: %v", id, path, err)
+        return
+    }
+    fmt.Fprintf(r.out, "  rolled back resource %s for %s\n", id, path)
+}